@@ -0,0 +1,52 @@
+// Command reindex backfills knowledge_embeddings for any knowledge rows
+// that predate the embedder being configured, such as rows written by an
+// older build of the server. Run it once after turning on embeddings. Only
+// rows with no stored vector are embedded; a row that already has one, even
+// from a different embedding model, is left as it is.
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/RichardoC/Pad-i/internal/db/sqlite"
+	"github.com/RichardoC/Pad-i/internal/embeddings"
+	"go.uber.org/zap"
+)
+
+func main() {
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+
+	embedder, err := embeddings.NewOpenAIEmbedder(
+		"http://localhost:11434/v1/",
+		os.Getenv("OPENAI_API_KEY"),
+		"nomic-embed-text",
+	)
+	if err != nil {
+		logger.Fatal("failed to initialize embedder", zap.Error(err))
+	}
+
+	// Reindexing reads and writes knowledge_embeddings directly, which isn't
+	// part of db.Store, so this tool always targets SQLite rather than
+	// dispatching through db.New. It still honors PAD_I_DB_DSN so it points
+	// at the same file the server does when that's been overridden from the
+	// default.
+	dbPath := os.Getenv("PAD_I_DB_DSN")
+	if dbPath == "" {
+		dbPath = "pad-i.db"
+	}
+	dbPath = strings.TrimPrefix(dbPath, "sqlite://")
+
+	database, err := sqlite.New(dbPath, embedder)
+	if err != nil {
+		logger.Fatal("failed to initialize database", zap.Error(err))
+	}
+
+	n, err := database.ReindexKnowledgeEmbeddings(context.Background())
+	if err != nil {
+		logger.Fatal("failed to reindex knowledge embeddings", zap.Error(err))
+	}
+	logger.Info("reindex complete", zap.Int("embedded", n))
+}
@@ -1,12 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"io/fs"
 	"net/http"
 	"os"
 
 	"github.com/RichardoC/Pad-i/internal/api"
 	"github.com/RichardoC/Pad-i/internal/db"
+	_ "github.com/RichardoC/Pad-i/internal/db/postgres"
+	"github.com/RichardoC/Pad-i/internal/db/sqlite"
+	"github.com/RichardoC/Pad-i/internal/embeddings"
 	"github.com/RichardoC/Pad-i/internal/llm"
+	"github.com/RichardoC/Pad-i/internal/trace"
 	"go.uber.org/zap"
 )
 
@@ -14,35 +21,112 @@ func main() {
 	logger, _ := zap.NewProduction()
 	defer logger.Sync()
 
-	// Initialize database with more detailed error logging
-	database, err := db.New("pad-i.db")
+	embedder, err := embeddings.NewOpenAIEmbedder(
+		"http://localhost:11434/v1/",
+		os.Getenv("OPENAI_API_KEY"),
+		"nomic-embed-text",
+	)
+	if err != nil {
+		logger.Fatal("failed to initialize embedder", zap.Error(err))
+	}
+
+	// PAD_I_DB_DSN picks the storage backend by URL scheme (sqlite:// or
+	// postgres://), defaulting to the same SQLite file this server has
+	// always used. internal/db/postgres is a real db.Store implementation,
+	// but this server is written directly against *sqlite.Database (agents,
+	// branching, hybrid search, starter caching all go through sqlite-only
+	// methods outside that interface), so there's no reduced-feature mode to
+	// fall back to yet -- a non-SQLite DSN fails fast here rather than
+	// surfacing as missing functionality later.
+	dbDSN := os.Getenv("PAD_I_DB_DSN")
+	if dbDSN == "" {
+		dbDSN = "sqlite://pad-i.db"
+	}
+	store, err := db.New(dbDSN, embedder)
 	if err != nil {
 		logger.Fatal("failed to initialize database",
 			zap.Error(err),
-			zap.String("dbPath", "pad-i.db"))
+			zap.String("dbDSN", dbDSN))
+	}
+	database, ok := store.(*sqlite.Database)
+	if !ok {
+		logger.Fatal("this server only runs against the sqlite backend; internal/db/postgres exists but has no caller in this repo yet (see its package doc)",
+			zap.String("dbDSN", dbDSN))
 	}
 
+	// Workspace root scopes the dir_tree and read_file agent tools; default
+	// to the current directory when unset.
+	workspaceRoot := os.Getenv("PAD_I_WORKSPACE_ROOT")
+	if workspaceRoot == "" {
+		workspaceRoot = "."
+	}
+
+	// Load model presets from ~/.config/pad-i/models.yaml (overridable via
+	// PAD_I_MODELS_CONFIG), falling back to a single local Ollama preset if
+	// no config file has been set up yet.
+	configPath := os.Getenv("PAD_I_MODELS_CONFIG")
+	if configPath == "" {
+		configPath, err = llm.DefaultConfigPath()
+		if err != nil {
+			logger.Fatal("failed to resolve model config path", zap.Error(err))
+		}
+	}
+
+	presets, defaultPreset, err := llm.LoadPresets(configPath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logger.Fatal("failed to load model config", zap.Error(err), zap.String("path", configPath))
+		}
+		logger.Info("no model config found, falling back to local Ollama", zap.String("path", configPath))
+		presets, defaultPreset = llm.DefaultPresets()
+	}
+
+	// tracer records per-request trans_id steps (knowledge search, LLM call,
+	// persisting the reply) so GET /api/trace can explain a slow or
+	// unexpected completion after the fact.
+	tracer := trace.NewRecorder()
+
 	// Initialize LLM service
-	llmService, err := llm.New(
-		"http://localhost:11434/v1/",
-		os.Getenv("OPENAI_API_KEY"),
-		"llama3.1:8b",
-		database,
-	)
+	llmService, err := llm.New(presets, defaultPreset, database, workspaceRoot, tracer)
 	if err != nil {
 		logger.Fatal("failed to initialize LLM service", zap.Error(err))
 	}
 
+	// Backfill embeddings for any knowledge rows written before an embedder
+	// was configured, in the background so a large knowledge base doesn't
+	// delay the server coming up.
+	go func() {
+		n, err := llmService.ReindexKnowledge(context.Background())
+		if err != nil {
+			logger.Error("failed to backfill knowledge embeddings", zap.Error(err))
+			return
+		}
+		if n > 0 {
+			logger.Info("backfilled knowledge embeddings", zap.Int("count", n))
+		}
+	}()
+
 	// Initialize HTTP handler
-	handler := api.NewHandler(database, llmService, logger)
-
-	// Set up routes
-	http.HandleFunc("/api/message", handler.HandleMessage)
-	http.HandleFunc("/api/conversations", handler.GetConversations)
-	http.HandleFunc("/api/messages", handler.GetMessages)
-	http.HandleFunc("/api/knowledge/search", handler.SearchKnowledge)
-	http.HandleFunc("/api/conversations/delete", handler.DeleteConversation)
-	http.HandleFunc("/api/conversations/update", handler.UpdateConversation)
+	handler := api.NewHandler(database, llmService, logger, tracer)
+
+	// Set up routes. Every request is wrapped in handler.WithTracing, which
+	// assigns it a fresh trans_id and records its start/end against it.
+	http.HandleFunc("/api/message", handler.WithTracing(handler.HandleMessage))
+	http.HandleFunc("/api/message/stream", handler.WithTracing(handler.HandleMessageStream))
+	http.HandleFunc("/api/conversations", handler.WithTracing(handler.GetConversations))
+	http.HandleFunc("/api/messages", handler.WithTracing(handler.GetMessages))
+	http.HandleFunc("/api/messages/page", handler.WithTracing(handler.GetMessagesPage))
+	http.HandleFunc("/api/messages/edit", handler.WithTracing(handler.EditMessage))
+	http.HandleFunc("/api/messages/select", handler.WithTracing(handler.SelectBranch))
+	http.HandleFunc("/api/conversations/tree", handler.WithTracing(handler.ConversationTree))
+	http.HandleFunc("/api/conversations/starters", handler.WithTracing(handler.ConversationStarters))
+	http.HandleFunc("/api/conversations/starters/new", handler.WithTracing(handler.NewConversationStarters))
+	http.HandleFunc("/api/knowledge/search", handler.WithTracing(handler.SearchKnowledge))
+	http.HandleFunc("/api/models", handler.WithTracing(handler.Models))
+	http.HandleFunc("/api/conversations/delete", handler.WithTracing(handler.DeleteConversation))
+	http.HandleFunc("/api/conversations/update", handler.WithTracing(handler.UpdateConversation))
+	http.HandleFunc("/api/agents", handler.WithTracing(handler.Agents))
+	http.HandleFunc("/api/trace", handler.WithTracing(handler.Trace))
 
 	// Serve static files
 	fs := http.FileServer(http.Dir("web"))
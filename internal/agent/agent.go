@@ -0,0 +1,205 @@
+// Package agent implements a small tool-calling ReAct loop on top of
+// langchaingo's OpenAI-compatible chat interface: an Agent owns a system
+// prompt and a set of Tools, drives the model through multiple turns,
+// executes whatever tool calls the model requests, and returns once the
+// model answers with plain text.
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// ParameterSpec describes one argument a Tool accepts, mirroring the subset
+// of JSON Schema that OpenAI-compatible tool-calling APIs expect.
+type ParameterSpec struct {
+	Name        string
+	Type        string // "string", "number", "boolean", "object", "array"
+	Description string
+	Required    bool
+}
+
+// Tool is a single capability an Agent can invoke as part of its loop.
+type Tool interface {
+	Name() string
+	Description() string
+	Parameters() []ParameterSpec
+	Execute(ctx context.Context, args map[string]any) (string, error)
+}
+
+// Agent drives a multi-turn tool-calling conversation against an LLM.
+type Agent struct {
+	Name         string
+	SystemPrompt string
+	Tools        []Tool
+	LLM          llms.Model
+
+	// MaxTurns bounds how many tool-call round-trips Run performs before
+	// giving up, so a misbehaving model can't loop forever.
+	MaxTurns int
+}
+
+// New constructs an Agent with a sane default turn limit.
+func New(name, systemPrompt string, tools []Tool, llm llms.Model) *Agent {
+	return &Agent{
+		Name:         name,
+		SystemPrompt: systemPrompt,
+		Tools:        tools,
+		LLM:          llm,
+		MaxTurns:     8,
+	}
+}
+
+// Run sends userMessage to the LLM and executes tool calls until the model
+// answers with plain text, returning that text. A streaming callback passed
+// through opts (e.g. llms.WithStreamingFunc) only fires chunks for the
+// final, tool-call-free turn: Run buffers every turn's chunks and replays
+// them to the real callback only once that turn's response comes back with
+// no tool calls, discarding the buffer otherwise, since a tool-call turn's
+// chunks can be raw tool-call argument JSON rather than assistant-facing
+// text. langchaingo's streaming callback doesn't tag chunks by kind, so this
+// trades live, token-by-token delivery for every turn (even pure-text ones)
+// for the guarantee that a caller's callback never sees tool-call JSON.
+func (a *Agent) Run(ctx context.Context, userMessage string, opts ...llms.CallOption) (string, error) {
+	messages := []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeSystem, a.SystemPrompt),
+		llms.TextParts(llms.ChatMessageTypeHuman, userMessage),
+	}
+
+	maxTurns := a.MaxTurns
+	if maxTurns <= 0 {
+		maxTurns = 8
+	}
+
+	var base llms.CallOptions
+	for _, opt := range opts {
+		opt(&base)
+	}
+	streamingFunc := base.StreamingFunc
+
+	callOpts := append([]llms.CallOption{llms.WithTools(a.toolDefinitions())}, opts...)
+
+	for turn := 0; turn < maxTurns; turn++ {
+		turnOpts := callOpts
+		var buffered [][]byte
+		if streamingFunc != nil {
+			turnOpts = append(append([]llms.CallOption{}, callOpts...), llms.WithStreamingFunc(
+				func(_ context.Context, chunk []byte) error {
+					buffered = append(buffered, append([]byte(nil), chunk...))
+					return nil
+				},
+			))
+		}
+
+		resp, err := a.LLM.GenerateContent(ctx, messages, turnOpts...)
+		if err != nil {
+			return "", fmt.Errorf("agent %s: generate content: %w", a.Name, err)
+		}
+		if len(resp.Choices) == 0 {
+			return "", fmt.Errorf("agent %s: model returned no choices", a.Name)
+		}
+
+		choice := resp.Choices[0]
+		if len(choice.ToolCalls) == 0 {
+			for _, chunk := range buffered {
+				if err := streamingFunc(ctx, chunk); err != nil {
+					return "", fmt.Errorf("agent %s: streaming func: %w", a.Name, err)
+				}
+			}
+			return choice.Content, nil
+		}
+
+		assistantMsg := llms.MessageContent{Role: llms.ChatMessageTypeAI}
+		for _, tc := range choice.ToolCalls {
+			assistantMsg.Parts = append(assistantMsg.Parts, tc)
+		}
+		messages = append(messages, assistantMsg)
+
+		for _, tc := range choice.ToolCalls {
+			result, err := a.executeToolCall(ctx, tc)
+			if err != nil {
+				result = fmt.Sprintf("error: %v", err)
+			}
+			messages = append(messages, llms.MessageContent{
+				Role: llms.ChatMessageTypeTool,
+				Parts: []llms.ContentPart{
+					llms.ToolCallResponse{
+						ToolCallID: tc.ID,
+						Name:       toolCallName(tc),
+						Content:    result,
+					},
+				},
+			})
+		}
+	}
+
+	return "", fmt.Errorf("agent %s: exceeded %d tool-call turns without a final answer", a.Name, maxTurns)
+}
+
+func (a *Agent) tool(name string) (Tool, bool) {
+	for _, t := range a.Tools {
+		if t.Name() == name {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+func (a *Agent) toolDefinitions() []llms.Tool {
+	defs := make([]llms.Tool, 0, len(a.Tools))
+	for _, t := range a.Tools {
+		properties := map[string]any{}
+		var required []string
+		for _, p := range t.Parameters() {
+			properties[p.Name] = map[string]any{
+				"type":        p.Type,
+				"description": p.Description,
+			}
+			if p.Required {
+				required = append(required, p.Name)
+			}
+		}
+		defs = append(defs, llms.Tool{
+			Type: "function",
+			Function: &llms.FunctionDefinition{
+				Name:        t.Name(),
+				Description: t.Description(),
+				Parameters: map[string]any{
+					"type":       "object",
+					"properties": properties,
+					"required":   required,
+				},
+			},
+		})
+	}
+	return defs
+}
+
+func (a *Agent) executeToolCall(ctx context.Context, tc llms.ToolCall) (string, error) {
+	if tc.FunctionCall == nil {
+		return "", fmt.Errorf("tool call %s has no function", tc.ID)
+	}
+	t, ok := a.tool(tc.FunctionCall.Name)
+	if !ok {
+		return "", fmt.Errorf("unknown tool %q", tc.FunctionCall.Name)
+	}
+
+	var args map[string]any
+	if raw := tc.FunctionCall.Arguments; raw != "" {
+		if err := json.Unmarshal([]byte(raw), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments for tool %q: %w", tc.FunctionCall.Name, err)
+		}
+	}
+
+	return t.Execute(ctx, args)
+}
+
+func toolCallName(tc llms.ToolCall) string {
+	if tc.FunctionCall == nil {
+		return ""
+	}
+	return tc.FunctionCall.Name
+}
@@ -0,0 +1,220 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/RichardoC/Pad-i/internal/db/sqlite"
+)
+
+// Defaults for the search_knowledge tool; agents always get the same
+// retrieval depth and relevance bar rather than choosing them per call.
+const (
+	searchKnowledgeTopK     = 5
+	searchKnowledgeMinScore = 0.5
+)
+
+// SearchKnowledgeTool lets an Agent search the stored knowledge base.
+type SearchKnowledgeTool struct {
+	DB *sqlite.Database
+}
+
+func (t *SearchKnowledgeTool) Name() string { return "search_knowledge" }
+
+func (t *SearchKnowledgeTool) Description() string {
+	return "Search the stored knowledge base for facts relevant to a query."
+}
+
+func (t *SearchKnowledgeTool) Parameters() []ParameterSpec {
+	return []ParameterSpec{
+		{Name: "query", Type: "string", Description: "The search query", Required: true},
+	}
+}
+
+func (t *SearchKnowledgeTool) Execute(ctx context.Context, args map[string]any) (string, error) {
+	query, _ := args["query"].(string)
+	if query == "" {
+		return "", fmt.Errorf("search_knowledge requires a non-empty \"query\" argument")
+	}
+
+	results, err := t.DB.SearchKnowledge(ctx, query, searchKnowledgeTopK, searchKnowledgeMinScore)
+	if err != nil {
+		return "", fmt.Errorf("failed to search knowledge base: %w", err)
+	}
+	if len(results) == 0 {
+		return "no matching knowledge found", nil
+	}
+
+	var sb strings.Builder
+	for _, r := range results {
+		fmt.Fprintf(&sb, "- %s\n", r.Content)
+	}
+	return sb.String(), nil
+}
+
+// StoreKnowledgeTool lets an Agent persist a fact to the knowledge base.
+type StoreKnowledgeTool struct {
+	DB     *sqlite.Database
+	ConvID int64
+}
+
+func (t *StoreKnowledgeTool) Name() string { return "store_knowledge" }
+
+func (t *StoreKnowledgeTool) Description() string {
+	return "Store a piece of information in the knowledge base for later retrieval."
+}
+
+func (t *StoreKnowledgeTool) Parameters() []ParameterSpec {
+	return []ParameterSpec{
+		{Name: "content", Type: "string", Description: "The information to store", Required: true},
+	}
+}
+
+func (t *StoreKnowledgeTool) Execute(ctx context.Context, args map[string]any) (string, error) {
+	content, _ := args["content"].(string)
+	if content == "" {
+		return "", fmt.Errorf("store_knowledge requires a non-empty \"content\" argument")
+	}
+
+	if err := t.DB.SaveToKnowledgeBase(ctx, content, t.ConvID); err != nil {
+		return "", fmt.Errorf("failed to store knowledge: %w", err)
+	}
+	return "stored", nil
+}
+
+// CreateConversationTool lets an Agent start a new conversation thread.
+type CreateConversationTool struct {
+	DB *sqlite.Database
+}
+
+func (t *CreateConversationTool) Name() string { return "create_conversation" }
+
+func (t *CreateConversationTool) Description() string {
+	return "Create a new conversation, for use when the topic changes significantly."
+}
+
+func (t *CreateConversationTool) Parameters() []ParameterSpec {
+	return []ParameterSpec{
+		{Name: "title", Type: "string", Description: "Title for the new conversation", Required: true},
+	}
+}
+
+func (t *CreateConversationTool) Execute(ctx context.Context, args map[string]any) (string, error) {
+	title, _ := args["title"].(string)
+	if title == "" {
+		return "", fmt.Errorf("create_conversation requires a non-empty \"title\" argument")
+	}
+
+	conv, err := t.DB.CreateConversation(ctx, title, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to create conversation: %w", err)
+	}
+	return fmt.Sprintf("created conversation %d: %s", conv.ID, conv.Title), nil
+}
+
+// DirTreeTool lets an Agent list files beneath a path scoped to its
+// workspace root.
+type DirTreeTool struct {
+	Root string
+}
+
+func (t *DirTreeTool) Name() string { return "dir_tree" }
+
+func (t *DirTreeTool) Description() string {
+	return "List files and directories beneath a path relative to the workspace root."
+}
+
+func (t *DirTreeTool) Parameters() []ParameterSpec {
+	return []ParameterSpec{
+		{Name: "path", Type: "string", Description: "Path relative to the workspace root (default \".\")", Required: false},
+	}
+}
+
+func (t *DirTreeTool) Execute(ctx context.Context, args map[string]any) (string, error) {
+	rel, _ := args["path"].(string)
+	if rel == "" {
+		rel = "."
+	}
+
+	abs, err := resolveWorkspacePath(t.Root, rel)
+	if err != nil {
+		return "", err
+	}
+	absRoot, err := filepath.Abs(t.Root)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	walkErr := filepath.WalkDir(abs, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(absRoot, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(&sb, rel)
+		return nil
+	})
+	if walkErr != nil {
+		return "", fmt.Errorf("failed to list %q: %w", rel, walkErr)
+	}
+	return sb.String(), nil
+}
+
+// ReadFileTool lets an Agent read a single file's contents, scoped to its
+// workspace root.
+type ReadFileTool struct {
+	Root string
+}
+
+func (t *ReadFileTool) Name() string { return "read_file" }
+
+func (t *ReadFileTool) Description() string {
+	return "Read the contents of a file relative to the workspace root."
+}
+
+func (t *ReadFileTool) Parameters() []ParameterSpec {
+	return []ParameterSpec{
+		{Name: "path", Type: "string", Description: "Path relative to the workspace root", Required: true},
+	}
+}
+
+func (t *ReadFileTool) Execute(ctx context.Context, args map[string]any) (string, error) {
+	rel, _ := args["path"].(string)
+	if rel == "" {
+		return "", fmt.Errorf("read_file requires a non-empty \"path\" argument")
+	}
+
+	abs, err := resolveWorkspacePath(t.Root, rel)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %q: %w", rel, err)
+	}
+	return string(data), nil
+}
+
+// resolveWorkspacePath joins rel onto root and rejects any path that would
+// escape root, so workspace-scoped tools can't read files elsewhere on disk.
+func resolveWorkspacePath(root, rel string) (string, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	absPath, err := filepath.Abs(filepath.Join(absRoot, rel))
+	if err != nil {
+		return "", err
+	}
+	if absPath != absRoot && !strings.HasPrefix(absPath, absRoot+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q escapes workspace root", rel)
+	}
+	return absPath, nil
+}
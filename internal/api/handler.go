@@ -1,31 +1,89 @@
 package api
 
 import (
+    "database/sql"
     "encoding/json"
+    "errors"
     "fmt"
     "net/http"
     "strconv"
+    "time"
 
     "github.com/RichardoC/Pad-i/internal/db"
+    "github.com/RichardoC/Pad-i/internal/db/sqlite"
     "github.com/RichardoC/Pad-i/internal/llm"
     "github.com/RichardoC/Pad-i/internal/models"
+    "github.com/RichardoC/Pad-i/internal/trace"
+    "github.com/google/uuid"
     "go.uber.org/zap"
 )
 
 type Handler struct {
-    db      *db.Database
+    db      *sqlite.Database
     llm     *llm.Service
     logger  *zap.Logger
+    tracer  *trace.Recorder
 }
 
-func NewHandler(database *db.Database, llmService *llm.Service, logger *zap.Logger) *Handler {
+func NewHandler(database *sqlite.Database, llmService *llm.Service, logger *zap.Logger, tracer *trace.Recorder) *Handler {
     return &Handler{
         db:     database,
         llm:    llmService,
         logger: logger,
+        tracer: tracer,
     }
 }
 
+// WithTracing wraps next so every inbound request gets a fresh trans_id
+// attached to its context (picked up by zap log lines and stamped onto any
+// message row the request persists) and recorded as the first and last
+// steps of its own trace log.
+func (h *Handler) WithTracing(next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        transID := uuid.NewString()
+        start := time.Now()
+
+        ctx := trace.WithTransID(r.Context(), transID)
+        r = r.WithContext(ctx)
+        w.Header().Set("X-Trans-Id", transID)
+
+        h.tracer.Record(transID, "request_start", r.Method+" "+r.URL.Path, 0)
+        next(w, r)
+        duration := time.Since(start)
+        h.tracer.Record(transID, "request_end", "", duration)
+
+        h.logger.Debug("handled request",
+            zap.String("trans_id", transID),
+            zap.String("method", r.Method),
+            zap.String("path", r.URL.Path),
+            zap.Duration("duration", duration))
+    }
+}
+
+// Trace returns the ordered log of steps recorded for a single request, by
+// its trans_id, for debugging slow or unexpected completions after the fact.
+func (h *Handler) Trace(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    transID := r.URL.Query().Get("trans_id")
+    if transID == "" {
+        http.Error(w, "Query parameter 'trans_id' is required", http.StatusBadRequest)
+        return
+    }
+
+    events, ok := h.tracer.Get(transID)
+    if !ok {
+        http.Error(w, "Unknown trans_id", http.StatusNotFound)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(events)
+}
+
 type MessageRequest struct {
     Content string `json:"content"`
 }
@@ -33,15 +91,34 @@ type MessageRequest struct {
 type MessageResponse struct {
     Message *models.Message `json:"message"`
     NewConversationID int64 `json:"new_conversation_id,omitempty"`
+    EditedRevision int64 `json:"edited_revision,omitempty"`
 }
 
 // Add this new type for conversation creation requests
 type CreateConversationRequest struct {
     Title string `json:"title"`
+    Agent string `json:"agent,omitempty"` // name of a registered agent to scope this conversation to
 }
 
 type UpdateConversationRequest struct {
-    Title string `json:"title"`
+    Title            string `json:"title"`
+    ExpectedRevision int64  `json:"expected_revision"`
+}
+
+type EditMessageRequest struct {
+    Content          string `json:"content"`
+    ExpectedRevision int64  `json:"expected_revision"`
+}
+
+// StartersRequest is the body for NewConversationStarters, naming which
+// agent's persona to generate suggestions for.
+type StartersRequest struct {
+    AgentName string `json:"agent_name"`
+}
+
+type StartersResponse struct {
+    Starters  []string `json:"starters"`
+    LatencyMS int64    `json:"latency_ms"`
 }
 
 func (h *Handler) HandleMessage(w http.ResponseWriter, r *http.Request) {
@@ -69,17 +146,19 @@ func (h *Handler) HandleMessage(w http.ResponseWriter, r *http.Request) {
         ConvID:  convID,
         Role:    "user",
         Content: req.Content,
+        TransID: trace.TransIDFromContext(r.Context()),
     }
 
     // Save user message
-    if err := h.db.SaveMessage(userMsg); err != nil {
+    if err := h.db.SaveMessage(r.Context(), userMsg); err != nil {
         h.logger.Error("Failed to save user message", zap.Error(err))
         http.Error(w, fmt.Sprintf("Failed to save message: %v", err), http.StatusInternalServerError)
         return
     }
 
-    // Process message with LLM
-    response, err := h.llm.ProcessMessage(r.Context(), *userMsg)
+    // Process message with LLM, optionally overriding the conversation's
+    // model preset for just this call
+    response, err := h.llm.ProcessMessage(r.Context(), *userMsg, r.URL.Query().Get("model"))
     if err != nil {
         h.logger.Error("Failed to process message", zap.Error(err))
         http.Error(w, fmt.Sprintf("Failed to process message: %v", err), http.StatusInternalServerError)
@@ -98,11 +177,145 @@ func (h *Handler) HandleMessage(w http.ResponseWriter, r *http.Request) {
     }
 }
 
+// CreateAgentRequest registers a new named agent.
+type CreateAgentRequest struct {
+    Name         string   `json:"name"`
+    SystemPrompt string   `json:"system_prompt"`
+    Tools        []string `json:"tools"`
+}
+
+// Agents handles both listing registered agents (GET) and registering a new
+// one (POST).
+func (h *Handler) Agents(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        agents, err := h.db.GetAgents(r.Context())
+        if err != nil {
+            h.logger.Error("Failed to get agents", zap.Error(err))
+            http.Error(w, "Internal server error", http.StatusInternalServerError)
+            return
+        }
+
+        w.Header().Set("Content-Type", "application/json")
+        if err := json.NewEncoder(w).Encode(agents); err != nil {
+            h.logger.Error("Failed to encode agents", zap.Error(err))
+            http.Error(w, "Internal server error", http.StatusInternalServerError)
+            return
+        }
+
+    case http.MethodPost:
+        var req CreateAgentRequest
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            http.Error(w, "Invalid request body", http.StatusBadRequest)
+            return
+        }
+        if req.Name == "" {
+            http.Error(w, "Agent name is required", http.StatusBadRequest)
+            return
+        }
+
+        agentDef, err := h.db.CreateAgent(r.Context(), req.Name, req.SystemPrompt, req.Tools)
+        if err != nil {
+            h.logger.Error("Failed to create agent", zap.Error(err))
+            http.Error(w, "Internal server error", http.StatusInternalServerError)
+            return
+        }
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(agentDef)
+
+    default:
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+    }
+}
+
+// StreamFrame is a single Server-Sent Events payload pushed by
+// HandleMessageStream: either a partial "delta" or the final "done" frame
+// carrying the persisted message.
+type StreamFrame struct {
+    Delta   string          `json:"delta,omitempty"`
+    Done    bool            `json:"done,omitempty"`
+    Message *models.Message `json:"message,omitempty"`
+    Error   string          `json:"error,omitempty"`
+}
+
+// HandleMessageStream is the streaming counterpart to HandleMessage: it
+// upgrades the response to text/event-stream and pushes one frame per chunk
+// of the assistant's final reply, followed by a final frame carrying the
+// persisted assistant message. The chunk frames are sent only once the LLM
+// has finished that reply (see llm.Service.ProcessMessageStream), not as each
+// token arrives.
+func (h *Handler) HandleMessageStream(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+        return
+    }
+
+    convID, err := strconv.ParseInt(r.URL.Query().Get("conversation_id"), 10, 64)
+    if err != nil {
+        http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+        return
+    }
+
+    var req MessageRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+
+    userMsg := &models.Message{
+        ConvID:  convID,
+        Role:    "user",
+        Content: req.Content,
+        TransID: trace.TransIDFromContext(r.Context()),
+    }
+
+    if err := h.db.SaveMessage(r.Context(), userMsg); err != nil {
+        h.logger.Error("Failed to save user message", zap.Error(err))
+        http.Error(w, fmt.Sprintf("Failed to save message: %v", err), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.Header().Set("Connection", "keep-alive")
+    w.WriteHeader(http.StatusOK)
+    flusher.Flush()
+
+    writeFrame := func(frame StreamFrame) {
+        data, err := json.Marshal(frame)
+        if err != nil {
+            h.logger.Error("Failed to encode stream frame", zap.Error(err))
+            return
+        }
+        fmt.Fprintf(w, "data: %s\n\n", data)
+        flusher.Flush()
+    }
+
+    response, err := h.llm.ProcessMessageStream(r.Context(), *userMsg, r.URL.Query().Get("model"), func(delta string) error {
+        writeFrame(StreamFrame{Delta: delta})
+        return nil
+    })
+    if err != nil {
+        h.logger.Error("Failed to process message", zap.Error(err))
+        writeFrame(StreamFrame{Error: err.Error()})
+        return
+    }
+
+    writeFrame(StreamFrame{Done: true, Message: response})
+}
+
 // Update the GetConversations handler to handle both GET and POST
 func (h *Handler) GetConversations(w http.ResponseWriter, r *http.Request) {
     switch r.Method {
     case http.MethodGet:
-        conversations, err := h.db.GetConversations()
+        conversations, err := h.db.GetConversations(r.Context())
         if err != nil {
             h.logger.Error("Failed to get conversations", 
                 zap.Error(err),
@@ -135,7 +348,25 @@ func (h *Handler) GetConversations(w http.ResponseWriter, r *http.Request) {
             return
         }
 
-        conversation, err := h.db.CreateConversation(req.Title)
+        model := r.URL.Query().Get("model")
+        if model != "" && !h.llm.HasPreset(model) {
+            http.Error(w, fmt.Sprintf("unknown model preset %q", model), http.StatusBadRequest)
+            return
+        }
+
+        if req.Agent != "" {
+            if _, err := h.db.GetAgentByName(r.Context(), req.Agent); err != nil {
+                if errors.Is(err, sql.ErrNoRows) {
+                    http.Error(w, fmt.Sprintf("unknown agent %q", req.Agent), http.StatusBadRequest)
+                    return
+                }
+                h.logger.Error("Failed to look up agent", zap.Error(err))
+                http.Error(w, "Internal server error", http.StatusInternalServerError)
+                return
+            }
+        }
+
+        conversation, err := h.db.CreateConversationWithAgent(r.Context(), req.Title, model, req.Agent)
         if err != nil {
             h.logger.Error("Failed to create conversation", zap.Error(err))
             http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -162,7 +393,7 @@ func (h *Handler) GetMessages(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    messages, err := h.db.GetConversationHistory(convID, 50)
+    messages, err := h.db.GetConversationHistory(r.Context(), convID, 50)
     if err != nil {
         h.logger.Error("Failed to get messages", zap.Error(err))
         http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -173,6 +404,221 @@ func (h *Handler) GetMessages(w http.ResponseWriter, r *http.Request) {
     json.NewEncoder(w).Encode(messages)
 }
 
+// GetMessagesPage returns one page of a conversation's active-branch
+// history, most recent first, via cursor-based pagination (see
+// sqlite.Database.GetConversationHistoryPage). Pass no cursor query
+// parameter for the first page; pass the previous response's next_cursor to
+// continue further into the past.
+func (h *Handler) GetMessagesPage(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    convID, err := strconv.ParseInt(r.URL.Query().Get("conversation_id"), 10, 64)
+    if err != nil {
+        http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+        return
+    }
+
+    limit := 50
+    if l := r.URL.Query().Get("limit"); l != "" {
+        parsed, err := strconv.Atoi(l)
+        if err != nil {
+            http.Error(w, "Invalid limit", http.StatusBadRequest)
+            return
+        }
+        limit = parsed
+    }
+
+    messages, nextCursor, err := h.db.GetConversationHistoryPage(r.Context(), convID, r.URL.Query().Get("cursor"), limit)
+    if err != nil {
+        h.logger.Error("Failed to get message page", zap.Error(err))
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(struct {
+        Messages   []models.Message `json:"messages"`
+        NextCursor string           `json:"next_cursor,omitempty"`
+    }{Messages: messages, NextCursor: nextCursor})
+}
+
+// EditMessage replaces a message with edited content on a new sibling
+// branch, then re-runs the LLM from that point so the edited message gets a
+// fresh reply.
+func (h *Handler) EditMessage(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    msgID, err := strconv.ParseInt(r.URL.Query().Get("message_id"), 10, 64)
+    if err != nil {
+        http.Error(w, "Invalid message ID", http.StatusBadRequest)
+        return
+    }
+
+    var req EditMessageRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+
+    edited, err := h.db.EditMessage(r.Context(), msgID, req.Content, trace.TransIDFromContext(r.Context()), req.ExpectedRevision)
+    if err != nil {
+        if errors.Is(err, db.ErrRevisionConflict) {
+            http.Error(w, "Message was edited by someone else; reload and try again", http.StatusConflict)
+            return
+        }
+        h.logger.Error("Failed to edit message", zap.Error(err))
+        http.Error(w, fmt.Sprintf("Failed to edit message: %v", err), http.StatusInternalServerError)
+        return
+    }
+
+    response, err := h.llm.ProcessMessage(r.Context(), *edited, r.URL.Query().Get("model"))
+    if err != nil {
+        h.logger.Error("Failed to process edited message", zap.Error(err))
+        http.Error(w, fmt.Sprintf("Failed to process message: %v", err), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(MessageResponse{
+        Message:           response,
+        NewConversationID: response.ConvID,
+        EditedRevision:    edited.Revision,
+    })
+}
+
+// ConversationTree returns every message in a conversation, active or not,
+// so the web UI can render a branch switcher for the full DAG.
+func (h *Handler) ConversationTree(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    convID, err := strconv.ParseInt(r.URL.Query().Get("conversation_id"), 10, 64)
+    if err != nil {
+        http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+        return
+    }
+
+    messages, err := h.db.GetConversationTree(r.Context(), convID)
+    if err != nil {
+        h.logger.Error("Failed to get conversation tree", zap.Error(err))
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(messages)
+}
+
+// SelectBranch marks the branch containing message_id as active, so it's
+// what GetMessages / the next reply will build on.
+func (h *Handler) SelectBranch(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    msgID, err := strconv.ParseInt(r.URL.Query().Get("message_id"), 10, 64)
+    if err != nil {
+        http.Error(w, "Invalid message ID", http.StatusBadRequest)
+        return
+    }
+
+    if err := h.db.SelectBranch(r.Context(), msgID); err != nil {
+        h.logger.Error("Failed to select branch", zap.Error(err))
+        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        return
+    }
+
+    w.WriteHeader(http.StatusOK)
+}
+
+// ConversationStarters returns cached or freshly generated prompt-starter
+// suggestions for an existing conversation, tailored to its recent history
+// and retrieved knowledge context.
+func (h *Handler) ConversationStarters(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    convID, err := strconv.ParseInt(r.URL.Query().Get("conversation_id"), 10, 64)
+    if err != nil {
+        http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+        return
+    }
+
+    limit := llm.DefaultStarterCount
+    if raw := r.URL.Query().Get("limit"); raw != "" {
+        parsed, err := strconv.Atoi(raw)
+        if err != nil || parsed < 1 {
+            http.Error(w, "Query parameter 'limit' must be a positive integer", http.StatusBadRequest)
+            return
+        }
+        limit = parsed
+    }
+
+    starters, elapsed, err := h.llm.GenerateStarters(r.Context(), convID, limit)
+    if err != nil {
+        h.logger.Error("Failed to generate starters", zap.Error(err))
+        http.Error(w, fmt.Sprintf("Failed to generate starters: %v", err), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(StartersResponse{
+        Starters:  starters,
+        LatencyMS: elapsed.Milliseconds(),
+    })
+}
+
+// NewConversationStarters returns prompt-starter suggestions for a
+// conversation that doesn't exist yet, based on the named agent's persona
+// instead of any history. Nothing is cached, since there's no conversation
+// row to cache it on.
+func (h *Handler) NewConversationStarters(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var req StartersRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+
+    limit := llm.DefaultStarterCount
+    if raw := r.URL.Query().Get("limit"); raw != "" {
+        parsed, err := strconv.Atoi(raw)
+        if err != nil || parsed < 1 {
+            http.Error(w, "Query parameter 'limit' must be a positive integer", http.StatusBadRequest)
+            return
+        }
+        limit = parsed
+    }
+
+    starters, elapsed, err := h.llm.GenerateStartersForAgent(r.Context(), req.AgentName, limit)
+    if err != nil {
+        h.logger.Error("Failed to generate starters", zap.Error(err))
+        http.Error(w, fmt.Sprintf("Failed to generate starters: %v", err), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(StartersResponse{
+        Starters:  starters,
+        LatencyMS: elapsed.Milliseconds(),
+    })
+}
+
 func (h *Handler) SearchKnowledge(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodGet {
         http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -185,15 +631,82 @@ func (h *Handler) SearchKnowledge(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    results, err := h.llm.SearchKnowledge(r.Context(), query)
-    if err != nil {
-        h.logger.Error("Failed to search knowledge", zap.Error(err))
-        http.Error(w, "Internal server error", http.StatusInternalServerError)
+    topK := llm.DefaultSearchTopK
+    if raw := r.URL.Query().Get("top_k"); raw != "" {
+        parsed, err := strconv.Atoi(raw)
+        if err != nil || parsed < 1 {
+            http.Error(w, "Query parameter 'top_k' must be a positive integer", http.StatusBadRequest)
+            return
+        }
+        topK = parsed
+    }
+
+    // mode=hybrid fuses FTS and embedding-similarity rankings via reciprocal
+    // rank fusion instead of the default cosine-similarity re-rank of FTS
+    // matches, and can surface a semantically close entry sharing no
+    // keywords with query. alpha (0-1) weights FTS against semantic; it's
+    // ignored outside hybrid mode.
+    switch r.URL.Query().Get("mode") {
+    case "", "fts":
+        minScore := llm.DefaultSearchMinScore
+        if raw := r.URL.Query().Get("min_score"); raw != "" {
+            parsed, err := strconv.ParseFloat(raw, 64)
+            if err != nil {
+                http.Error(w, "Query parameter 'min_score' must be a number", http.StatusBadRequest)
+                return
+            }
+            minScore = parsed
+        }
+
+        results, err := h.llm.SearchKnowledge(r.Context(), query, topK, minScore)
+        if err != nil {
+            h.logger.Error("Failed to search knowledge", zap.Error(err))
+            http.Error(w, "Internal server error", http.StatusInternalServerError)
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(results)
+
+    case "hybrid":
+        if !h.llm.HasEmbedder() {
+            http.Error(w, "Hybrid search requires an embedder, but none is configured", http.StatusBadRequest)
+            return
+        }
+
+        alpha := llm.DefaultHybridAlpha
+        if raw := r.URL.Query().Get("alpha"); raw != "" {
+            parsed, err := strconv.ParseFloat(raw, 64)
+            if err != nil || parsed < 0 || parsed > 1 {
+                http.Error(w, "Query parameter 'alpha' must be a number between 0 and 1", http.StatusBadRequest)
+                return
+            }
+            alpha = parsed
+        }
+
+        results, err := h.llm.HybridSearchKnowledge(r.Context(), query, topK, alpha)
+        if err != nil {
+            h.logger.Error("Failed to hybrid-search knowledge", zap.Error(err))
+            http.Error(w, "Internal server error", http.StatusInternalServerError)
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(results)
+
+    default:
+        http.Error(w, "Query parameter 'mode' must be 'fts' or 'hybrid'", http.StatusBadRequest)
+    }
+}
+
+// Models returns every configured model preset, for clients to offer as
+// choices when creating a conversation or sending a message.
+func (h *Handler) Models(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
         return
     }
 
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(results)
+    json.NewEncoder(w).Encode(h.llm.Presets())
 }
 
 func (h *Handler) DeleteConversation(w http.ResponseWriter, r *http.Request) {
@@ -208,7 +721,7 @@ func (h *Handler) DeleteConversation(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    if err := h.db.DeleteConversation(convID); err != nil {
+    if err := h.db.DeleteConversation(r.Context(), convID); err != nil {
         h.logger.Error("Failed to delete conversation", zap.Error(err))
         http.Error(w, "Internal server error", http.StatusInternalServerError)
         return
@@ -235,11 +748,19 @@ func (h *Handler) UpdateConversation(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    if err := h.db.UpdateConversationTitle(convID, req.Title); err != nil {
+    newRev, err := h.db.UpdateConversationTitle(r.Context(), convID, req.Title, req.ExpectedRevision)
+    if err != nil {
+        if errors.Is(err, db.ErrRevisionConflict) {
+            http.Error(w, "Conversation was updated by someone else; reload and try again", http.StatusConflict)
+            return
+        }
         h.logger.Error("Failed to update conversation", zap.Error(err))
         http.Error(w, "Internal server error", http.StatusInternalServerError)
         return
     }
 
-    w.WriteHeader(http.StatusOK)
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(struct {
+        Revision int64 `json:"revision"`
+    }{Revision: newRev})
 } 
\ No newline at end of file
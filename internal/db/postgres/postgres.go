@@ -0,0 +1,454 @@
+// Package postgres is a Postgres-backed implementation of db.Store, laying
+// the groundwork for a shared, multi-user database instead of the
+// single-file internal/db/sqlite backend. It only implements db.Store:
+// message branching/editing, registered agents, prompt-starter caching, and
+// hybrid search remain sqlite-only until a driver-neutral design for them
+// exists. Neither cmd/server nor cmd/reindex can run against this backend
+// yet -- both are written directly against *sqlite.Database for those
+// sqlite-only features -- so for now this package is only usable by a
+// caller built directly against db.Store.
+package postgres
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/RichardoC/Pad-i/internal/embeddings"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	core "github.com/RichardoC/Pad-i/internal/db"
+	"github.com/RichardoC/Pad-i/internal/models"
+)
+
+func init() {
+	opener := func(dsn string, embedder embeddings.Embedder) (core.Store, error) {
+		return New(dsn, embedder)
+	}
+	core.Register("postgres", opener)
+	core.Register("postgresql", opener)
+}
+
+// Database is a db.Store backed by a Postgres connection pool.
+type Database struct {
+	pool     *pgxpool.Pool
+	embedder embeddings.Embedder
+}
+
+// New connects to dsn (a standard postgres:// or postgresql:// connection
+// string, parsed by pgx) and ensures the schema this backend needs exists.
+// embedder may be nil, in which case knowledge is stored without an
+// embedding and SearchKnowledge falls back to lexical ranking alone.
+func New(dsn string, embedder embeddings.Embedder) (*Database, error) {
+	pool, err := pgxpool.Connect(context.Background(), dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+
+	database := &Database{pool: pool, embedder: embedder}
+	if err := database.ensureSchema(context.Background()); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to ensure schema: %w", err)
+	}
+	return database, nil
+}
+
+// ensureSchema creates the tables and indexes this backend needs if they
+// don't already exist. Unlike internal/db/sqlite, there's no versioned
+// migration history yet: this is the only schema this backend has ever had,
+// aside from the revision columns added below, which use ADD COLUMN IF NOT
+// EXISTS so a database created before they existed still picks them up.
+//
+// knowledge.search is a generated tsvector column rather than a trigger
+// (the approach internal/db/sqlite's FTS4 table uses), since Postgres can
+// keep it in sync declaratively. ON DELETE CASCADE on both messages and
+// knowledge replaces the manual multi-statement delete internal/db/sqlite's
+// DeleteConversation runs in a transaction.
+//
+// Each table's revision column is the same optimistic-concurrency counter
+// internal/db/sqlite added in its migration 7: UpdateConversationTitle and
+// UpdateKnowledge bump it on every update, guarded by a WHERE revision = $n
+// check, so a stale write reports ErrRevisionConflict instead of silently
+// clobbering a concurrent one.
+func (db *Database) ensureSchema(ctx context.Context) error {
+	_, err := db.pool.Exec(ctx, `
+        CREATE TABLE IF NOT EXISTS conversations (
+            id SERIAL PRIMARY KEY,
+            title TEXT NOT NULL,
+            model TEXT NOT NULL DEFAULT '',
+            created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+        );
+
+        CREATE TABLE IF NOT EXISTS messages (
+            id SERIAL PRIMARY KEY,
+            conversation_id INTEGER NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+            role TEXT NOT NULL,
+            content TEXT NOT NULL,
+            created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+        );
+
+        CREATE TABLE IF NOT EXISTS knowledge (
+            id SERIAL PRIMARY KEY,
+            content TEXT NOT NULL,
+            conversation_id INTEGER REFERENCES conversations(id) ON DELETE CASCADE,
+            created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            search tsvector GENERATED ALWAYS AS (to_tsvector('english', content)) STORED
+        );
+
+        CREATE INDEX IF NOT EXISTS knowledge_search_idx ON knowledge USING GIN (search);
+
+        CREATE TABLE IF NOT EXISTS knowledge_embeddings (
+            knowledge_id INTEGER PRIMARY KEY REFERENCES knowledge(id) ON DELETE CASCADE,
+            dim INTEGER NOT NULL,
+            vec BYTEA NOT NULL
+        );
+
+        ALTER TABLE conversations ADD COLUMN IF NOT EXISTS revision INTEGER NOT NULL DEFAULT 0;
+        ALTER TABLE messages ADD COLUMN IF NOT EXISTS revision INTEGER NOT NULL DEFAULT 0;
+        ALTER TABLE knowledge ADD COLUMN IF NOT EXISTS revision INTEGER NOT NULL DEFAULT 0;`)
+	return err
+}
+
+// SaveMessage persists msg. This backend doesn't implement message
+// branching/editing (see the package doc comment), so ParentID is always
+// cleared and Branch/Active always report the only state a message here can
+// have: branch 0, active.
+func (db *Database) SaveMessage(ctx context.Context, msg *models.Message) error {
+	msg.ParentID = nil
+	msg.Branch = 0
+	msg.Active = true
+
+	return db.pool.QueryRow(ctx, `
+        INSERT INTO messages (conversation_id, role, content)
+        VALUES ($1, $2, $3)
+        RETURNING id, created_at, revision`,
+		msg.ConvID, msg.Role, msg.Content,
+	).Scan(&msg.ID, &msg.CreatedAt, &msg.Revision)
+}
+
+// CreateConversation starts a new conversation. model selects which
+// configured model preset the conversation uses; an empty model defers to
+// the llm.Service's default preset.
+func (db *Database) CreateConversation(ctx context.Context, title, model string) (*models.Conversation, error) {
+	conv := &models.Conversation{Title: title, Model: model}
+	err := db.pool.QueryRow(ctx, `
+        INSERT INTO conversations (title, model)
+        VALUES ($1, $2)
+        RETURNING id, created_at, revision`,
+		title, model,
+	).Scan(&conv.ID, &conv.CreatedAt, &conv.Revision)
+	return conv, err
+}
+
+// SaveToKnowledgeBase stores content as a new knowledge row and, if db has
+// an embedder configured, computes and stores its embedding.
+func (db *Database) SaveToKnowledgeBase(ctx context.Context, content string, conversationID int64) error {
+	var id int64
+	err := db.pool.QueryRow(ctx, `
+        INSERT INTO knowledge (content, conversation_id)
+        VALUES ($1, $2)
+        RETURNING id`,
+		content, nullableConvID(conversationID),
+	).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	if db.embedder == nil {
+		return nil
+	}
+
+	// As in internal/db/sqlite, the embedding is populated outside the main
+	// insert: the knowledge row is already committed, and a failure here
+	// shouldn't be reported as a failed save. This uses the caller's ctx, so
+	// a canceled request aborts the embed call too.
+	vecs, err := db.embedder.Embed(ctx, []string{content})
+	if err != nil || len(vecs) == 0 {
+		fmt.Printf("Warning: failed to embed knowledge row %d: %v\n", id, err)
+		return nil
+	}
+
+	if _, err := db.pool.Exec(ctx, `
+        INSERT INTO knowledge_embeddings (knowledge_id, dim, vec)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (knowledge_id) DO UPDATE SET dim = EXCLUDED.dim, vec = EXCLUDED.vec`,
+		id, len(vecs[0]), encodeVector(vecs[0]),
+	); err != nil {
+		fmt.Printf("Warning: failed to store embedding for knowledge row %d: %v\n", id, err)
+	}
+	return nil
+}
+
+// nullableConvID turns the zero conversation ID (SaveToKnowledgeBase's
+// convention for "not tied to a conversation") into a SQL NULL, matching the
+// optional foreign key's column type.
+func nullableConvID(id int64) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// searchCandidatePoolSize bounds how many lexical matches SearchKnowledge
+// pulls in before similarity-ranking, mirroring internal/db/sqlite.
+const searchCandidatePoolSize = 200
+
+// SearchKnowledge returns up to topK stored knowledge entries relevant to
+// query. Lexical matching uses Postgres's plainto_tsquery against the
+// generated tsvector column, ranked by ts_rank; if db has an embedder
+// configured, the candidate pool is then re-ranked by embedding cosine
+// similarity, same as internal/db/sqlite.
+func (db *Database) SearchKnowledge(ctx context.Context, query string, topK int, minScore float64) ([]core.KnowledgeResult, error) {
+	rows, err := db.pool.Query(ctx, `
+        SELECT id, content, COALESCE(conversation_id, 0), created_at, revision, ts_rank(search, plainto_tsquery('english', $1)) AS score
+        FROM knowledge
+        WHERE search @@ plainto_tsquery('english', $1)
+        ORDER BY score DESC
+        LIMIT $2`, query, searchCandidatePoolSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search knowledge base: %w", err)
+	}
+	defer rows.Close()
+
+	var results []core.KnowledgeResult
+	for rows.Next() {
+		var r core.KnowledgeResult
+		if err := rows.Scan(&r.ID, &r.Content, &r.ConversationID, &r.CreatedAt, &r.Revision, &r.Score); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if db.embedder == nil {
+		if topK > 0 && len(results) > topK {
+			results = results[:topK]
+		}
+		return results, nil
+	}
+
+	ids := make([]int64, len(results))
+	for i, r := range results {
+		ids[i] = r.ID
+	}
+	vectors, err := db.knowledgeVectors(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load knowledge embeddings: %w", err)
+	}
+
+	var candidates []embeddings.Candidate
+	var unranked []core.KnowledgeResult
+	byID := make(map[int64]core.KnowledgeResult, len(results))
+	for _, r := range results {
+		byID[r.ID] = r
+		if vec, ok := vectors[r.ID]; ok {
+			candidates = append(candidates, embeddings.Candidate{ID: r.ID, Content: r.Content, Vec: vec})
+		} else {
+			unranked = append(unranked, r)
+		}
+	}
+
+	retriever := embeddings.NewRetriever(db.embedder)
+	scored, err := retriever.Retrieve(ctx, query, candidates, 0, minScore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank knowledge by similarity: %w", err)
+	}
+
+	ranked := make([]core.KnowledgeResult, 0, len(scored)+len(unranked))
+	for _, s := range scored {
+		r := byID[s.ID]
+		r.Score = s.Score
+		ranked = append(ranked, r)
+	}
+	ranked = append(ranked, unranked...)
+	if topK > 0 && len(ranked) > topK {
+		ranked = ranked[:topK]
+	}
+	return ranked, nil
+}
+
+// knowledgeVectors loads the stored embeddings for ids in a single query,
+// keyed by knowledge ID. IDs with no embedding yet are simply absent from
+// the result.
+func (db *Database) knowledgeVectors(ctx context.Context, ids []int64) (map[int64][]float32, error) {
+	vectors := make(map[int64][]float32, len(ids))
+	if len(ids) == 0 {
+		return vectors, nil
+	}
+
+	rows, err := db.pool.Query(ctx, `SELECT knowledge_id, vec FROM knowledge_embeddings WHERE knowledge_id = ANY($1)`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var buf []byte
+		if err := rows.Scan(&id, &buf); err != nil {
+			return nil, err
+		}
+		vectors[id] = decodeVector(buf)
+	}
+	return vectors, rows.Err()
+}
+
+// encodeVector packs a float32 vector as little-endian bytes for storage in
+// knowledge_embeddings.vec, matching internal/db/sqlite's encoding.
+func encodeVector(vec []float32) []byte {
+	buf := make([]byte, len(vec)*4)
+	for i, v := range vec {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(v))
+	}
+	return buf
+}
+
+// decodeVector is the inverse of encodeVector.
+func decodeVector(buf []byte) []float32 {
+	vec := make([]float32, len(buf)/4)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:]))
+	}
+	return vec
+}
+
+// GetConversationHistory returns up to limit messages for conversationID, in
+// the order they were sent. This backend has no message branching (see the
+// package doc comment), so unlike internal/db/sqlite this is a plain
+// chronological read, not a walk up the active branch's parent chain.
+func (db *Database) GetConversationHistory(ctx context.Context, conversationID int64, limit int) ([]models.Message, error) {
+	sqlLimit := limit
+	if sqlLimit <= 0 {
+		sqlLimit = -1 // ALL, via the NULL LIMIT below.
+	}
+
+	rows, err := db.pool.Query(ctx, `
+        SELECT id, conversation_id, role, content, created_at, revision
+        FROM messages
+        WHERE conversation_id = $1
+        ORDER BY id ASC
+        LIMIT NULLIF($2, -1)`, conversationID, sqlLimit)
+	if err != nil {
+		return []models.Message{}, fmt.Errorf("failed to load conversation history: %w", err)
+	}
+	defer rows.Close()
+
+	messages := make([]models.Message, 0)
+	for rows.Next() {
+		var msg models.Message
+		if err := rows.Scan(&msg.ID, &msg.ConvID, &msg.Role, &msg.Content, &msg.CreatedAt, &msg.Revision); err != nil {
+			return []models.Message{}, err
+		}
+		msg.Active = true
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// GetConversations returns every conversation, most recently created first.
+func (db *Database) GetConversations(ctx context.Context) ([]models.Conversation, error) {
+	rows, err := db.pool.Query(ctx, `
+        SELECT id, title, model, created_at, revision
+        FROM conversations
+        ORDER BY created_at DESC`)
+	if err != nil {
+		return []models.Conversation{}, err
+	}
+	defer rows.Close()
+
+	conversations := make([]models.Conversation, 0)
+	for rows.Next() {
+		var conv models.Conversation
+		if err := rows.Scan(&conv.ID, &conv.Title, &conv.Model, &conv.CreatedAt, &conv.Revision); err != nil {
+			return []models.Conversation{}, err
+		}
+		conversations = append(conversations, conv)
+	}
+	return conversations, rows.Err()
+}
+
+// DeleteConversation deletes a conversation and everything under it. Unlike
+// internal/db/sqlite's manual multi-statement transaction, this relies on
+// the ON DELETE CASCADE foreign keys declared in ensureSchema.
+func (db *Database) DeleteConversation(ctx context.Context, id int64) error {
+	tag, err := db.pool.Exec(ctx, `DELETE FROM conversations WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("conversation %d not found", id)
+	}
+	return nil
+}
+
+// UpdateConversationTitle renames conversation id, as long as its stored
+// revision matches expectedRev. See conflictOrNotFound for how a no-op update
+// is told apart from a genuine conflict.
+func (db *Database) UpdateConversationTitle(ctx context.Context, id int64, title string, expectedRev int64) (int64, error) {
+	var newRev int64
+	err := db.pool.QueryRow(ctx, `
+        UPDATE conversations SET title = $1, revision = revision + 1
+        WHERE id = $2 AND revision = $3
+        RETURNING revision`, title, id, expectedRev,
+	).Scan(&newRev)
+	if err != nil {
+		return 0, db.conflictOrNotFound(ctx, "conversations", id, err)
+	}
+	return newRev, nil
+}
+
+// UpdateKnowledge replaces a knowledge row's content, as long as its stored
+// revision matches expectedRev, and re-embeds it if db has an embedder
+// configured (mirroring SaveToKnowledgeBase).
+func (db *Database) UpdateKnowledge(ctx context.Context, id int64, content string, expectedRev int64) (int64, error) {
+	var newRev int64
+	err := db.pool.QueryRow(ctx, `
+        UPDATE knowledge SET content = $1, revision = revision + 1
+        WHERE id = $2 AND revision = $3
+        RETURNING revision`, content, id, expectedRev,
+	).Scan(&newRev)
+	if err != nil {
+		return 0, db.conflictOrNotFound(ctx, "knowledge", id, err)
+	}
+
+	if db.embedder != nil {
+		vecs, err := db.embedder.Embed(ctx, []string{content})
+		if err != nil || len(vecs) == 0 {
+			fmt.Printf("Warning: failed to embed knowledge row %d: %v\n", id, err)
+		} else if _, err := db.pool.Exec(ctx, `
+            INSERT INTO knowledge_embeddings (knowledge_id, dim, vec)
+            VALUES ($1, $2, $3)
+            ON CONFLICT (knowledge_id) DO UPDATE SET dim = EXCLUDED.dim, vec = EXCLUDED.vec`,
+			id, len(vecs[0]), encodeVector(vecs[0]),
+		); err != nil {
+			fmt.Printf("Warning: failed to store embedding for knowledge row %d: %v\n", id, err)
+		}
+	}
+
+	return newRev, nil
+}
+
+// conflictOrNotFound is called after an `UPDATE ... WHERE id = $x AND
+// revision = $y RETURNING ...` affects no rows (pgx reports this as
+// pgx.ErrNoRows on the RETURNING Scan). That can mean either id doesn't
+// exist or it exists with a different revision, so it re-reads the row to
+// tell the two apart: absent means the original error, present means
+// core.ErrRevisionConflict. Mirrors internal/db/sqlite's conflictOrNotFound.
+func (db *Database) conflictOrNotFound(ctx context.Context, table string, id int64, updateErr error) error {
+	if updateErr != pgx.ErrNoRows {
+		return updateErr
+	}
+
+	var exists bool
+	if err := db.pool.QueryRow(ctx, fmt.Sprintf(`SELECT true FROM %s WHERE id = $1`, table), id).Scan(&exists); err != nil {
+		if err == pgx.ErrNoRows {
+			return updateErr
+		}
+		return err
+	}
+	return core.ErrRevisionConflict
+}
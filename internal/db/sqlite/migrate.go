@@ -0,0 +1,179 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+)
+
+//go:embed schema/*.ddl
+var migrationFS embed.FS
+
+// migration is one versioned step: applying file brings the database from
+// version-1 to version.
+type migration struct {
+	version int
+	file    string
+}
+
+// migrations must stay ordered by version, starting at 1 with no gaps.
+// Adding schema changes means appending a new numbered primary_migration_*.ddl
+// file and an entry here, never editing an already-released one.
+var migrations = []migration{
+	{1, "schema/primary_1.ddl"},
+	{2, "schema/primary_migration_1_2.ddl"},
+	{3, "schema/primary_migration_2_3.ddl"},
+	{4, "schema/primary_migration_3_4.ddl"},
+	{5, "schema/primary_migration_4_5.ddl"},
+	{6, "schema/primary_migration_5_6.ddl"},
+	{7, "schema/primary_migration_6_7.ddl"},
+	{8, "schema/primary_migration_7_8.ddl"},
+}
+
+// latestSchemaVersion is the version New() migrates a database up to.
+const latestSchemaVersion = 8
+
+// SchemaVersion returns the database's current schema version.
+func (d *Database) SchemaVersion(ctx context.Context) (int, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var version int
+	err := d.db.QueryRowContext(ctx, `SELECT version FROM schema_meta WHERE id = 1`).Scan(&version)
+	return version, err
+}
+
+// Migrate brings the database up to targetVersion, applying each pending
+// migration in migrations, in order, each in its own transaction. It's safe
+// to call with a targetVersion the database has already reached; pending
+// migrations above it are simply left unapplied.
+func (d *Database) Migrate(ctx context.Context, targetVersion int) error {
+	current, err := ensureSchemaMeta(ctx, d.db)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current || m.version > targetVersion {
+			continue
+		}
+		if err := applyMigration(ctx, d.db, m); err != nil {
+			return fmt.Errorf("failed to apply migration %d: %w", m.version, err)
+		}
+	}
+	return nil
+}
+
+// applyMigration runs m.file's DDL and records the new version in a single
+// transaction, so a crash partway through leaves the database on the old
+// version rather than half-migrated with no record of it.
+func applyMigration(ctx context.Context, sqlDB *sql.DB, m migration) error {
+	ddl, err := migrationFS.ReadFile(m.file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", m.file, err)
+	}
+
+	tx, err := sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, string(ddl)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE schema_meta SET version = ? WHERE id = 1`, m.version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ensureSchemaMeta creates the schema_meta table if it doesn't exist yet and
+// returns the database's current version. A database that already has
+// tables but no schema_meta predates this migrations subsystem; its version
+// is inferred from which columns are already present, so migrations that
+// were previously applied ad hoc aren't re-run (and don't fail on already
+// existing columns).
+//
+// The whole check-then-insert runs in one transaction (the connection's
+// _txlock=immediate DSN option makes BeginTx grab the write lock up front)
+// so two processes opening the same fresh database at once can't both see
+// no row and both try to insert one.
+func ensureSchemaMeta(ctx context.Context, sqlDB *sql.DB) (int, error) {
+	tx, err := sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS schema_meta (
+            id INTEGER PRIMARY KEY CHECK (id = 1),
+            version INTEGER NOT NULL
+        )`); err != nil {
+		return 0, err
+	}
+
+	var version int
+	err = tx.QueryRowContext(ctx, `SELECT version FROM schema_meta WHERE id = 1`).Scan(&version)
+	if err == nil {
+		return version, tx.Commit()
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	version, err = inferLegacyVersion(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_meta (id, version) VALUES (1, ?)`, version); err != nil {
+		return 0, err
+	}
+	return version, tx.Commit()
+}
+
+// inferLegacyVersion looks at which tables and columns already exist to
+// determine the schema version of a database created before this migrations
+// subsystem existed, so its already-applied ad hoc column additions aren't
+// repeated. A brand new database, with none of its tables created yet,
+// starts at version 0, and so does one with no knowledge_embeddings table:
+// version 1's DDL is all CREATE ... IF NOT EXISTS, so re-running it only
+// adds the tables such a database is missing.
+func inferLegacyVersion(ctx context.Context, q querier) (int, error) {
+	convCols, err := tableColumns(ctx, q, "conversations")
+	if err != nil {
+		return 0, err
+	}
+	if len(convCols) == 0 {
+		return 0, nil
+	}
+	embCols, err := tableColumns(ctx, q, "knowledge_embeddings")
+	if err != nil {
+		return 0, err
+	}
+	if len(embCols) == 0 {
+		return 0, nil
+	}
+
+	msgCols, err := tableColumns(ctx, q, "messages")
+	if err != nil {
+		return 0, err
+	}
+
+	version := 1
+	if convCols["model"] {
+		version = 2
+	}
+	if msgCols["parent_id"] && msgCols["branch"] && msgCols["active"] {
+		version = 3
+	}
+	if convCols["starters"] && convCols["starters_generated_at"] {
+		version = 4
+	}
+	if msgCols["trans_id"] && msgCols["latency_ms"] && msgCols["knowledge_search_ms"] && msgCols["llm_ms"] && msgCols["db_ms"] {
+		version = 5
+	}
+	return version, nil
+}
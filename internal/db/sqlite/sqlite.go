@@ -0,0 +1,1452 @@
+// Package sqlite is the SQLite-backed implementation of db.Store, plus a
+// number of SQLite-specific features (agents, message branching, hybrid
+// search, prompt-starter caching) that go beyond what db.Store requires and
+// aren't yet available on other backends.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	core "github.com/RichardoC/Pad-i/internal/db"
+	"github.com/RichardoC/Pad-i/internal/embeddings"
+	"github.com/RichardoC/Pad-i/internal/models"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func init() {
+	core.Register("sqlite", func(dsn string, embedder embeddings.Embedder) (core.Store, error) {
+		return New(strings.TrimPrefix(dsn, "sqlite://"), embedder)
+	})
+}
+
+type Database struct {
+	db           *sql.DB
+	embedder     embeddings.Embedder
+	queryTimeout time.Duration
+}
+
+// defaultQueryTimeout bounds how long any single Database method's query or
+// transaction may run before its context is canceled, so a stuck query
+// can't hang the request that triggered it forever. SetQueryTimeout
+// overrides it.
+const defaultQueryTimeout = 10 * time.Second
+
+// New opens dbPath and applies the schema. embedder may be nil, in which
+// case knowledge is stored without an embedding and SearchKnowledge falls
+// back to plain FTS ranking.
+func New(dbPath string, embedder embeddings.Embedder) (*Database, error) {
+	// _txlock=immediate makes every transaction acquire its write lock at
+	// BEGIN rather than at the first write statement, so a read-then-write
+	// sequence like SaveMessage's "find the active leaf, then insert under
+	// it" can't interleave with a concurrent one and attach two messages to
+	// the same parent. _busy_timeout makes a writer that loses that race
+	// block and retry for up to 5s instead of failing immediately with
+	// SQLITE_BUSY, which otherwise an early request could hit while the
+	// startup embedding backfill is still writing.
+	db, err := sql.Open("sqlite3", dbPath+"?_txlock=immediate&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+
+	database := &Database{db: db, embedder: embedder, queryTimeout: defaultQueryTimeout}
+	if err := database.Migrate(context.Background(), latestSchemaVersion); err != nil {
+		return nil, err
+	}
+
+	return database, nil
+}
+
+// SetQueryTimeout overrides the per-query timeout applied to every Database
+// method's context. <= 0 disables the timeout, leaving cancellation
+// entirely up to the caller's own context.
+func (db *Database) SetQueryTimeout(d time.Duration) {
+	db.queryTimeout = d
+}
+
+// withTimeout bounds ctx by db.queryTimeout, if one is configured, so a
+// caller's own cancellation (e.g. a user aborting a streaming response) and
+// the default per-query timeout both apply. The returned cancel func must
+// stay in scope until the query and any rows it returns are fully consumed;
+// canceling early aborts an in-progress row scan just like a real timeout
+// would.
+func (db *Database) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db.queryTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, db.queryTimeout)
+}
+
+// Ping verifies the database connection is alive, bounded by db's per-query
+// timeout.
+func (db *Database) Ping(ctx context.Context) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	return db.db.PingContext(ctx)
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx, so helpers like
+// tableColumns can run either standalone or as part of a larger transaction.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// tableColumns returns the set of column names table currently has, via
+// PRAGMA table_info. Used by the migrations subsystem to infer the schema
+// version of a database that predates it.
+func tableColumns(ctx context.Context, q querier, table string) (map[string]bool, error) {
+	rows, err := q.QueryContext(ctx, fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect %s table: %w", table, err)
+	}
+	defer rows.Close()
+
+	cols := make(map[string]bool)
+	for rows.Next() {
+		var cid int
+		var name, colType string
+		var notNull, pk int
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return nil, fmt.Errorf("failed to read %s column info: %w", table, err)
+		}
+		cols[name] = true
+	}
+	return cols, rows.Err()
+}
+
+// SaveMessage persists msg. If msg.ParentID is nil, it's chained onto the
+// conversation's current active leaf, so a normal back-and-forth appends to
+// whichever branch is currently selected. A non-nil ParentID is stored as
+// given. EditMessage doesn't go through SaveMessage: it inserts its new
+// sibling branch's row itself.
+func (db *Database) SaveMessage(ctx context.Context, msg *models.Message) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	// Finding the active leaf and inserting under it run in one transaction
+	// (and the connection is opened with _txlock=immediate) so two
+	// concurrent saves to the same conversation can't both read the same
+	// leaf and attach themselves to it.
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if msg.ParentID == nil {
+		leafID, err := activeLeafID(ctx, tx, msg.ConvID)
+		if err != nil {
+			return fmt.Errorf("failed to find active leaf: %w", err)
+		}
+		msg.ParentID = leafID
+	}
+
+	query := `
+        INSERT INTO messages (
+            conversation_id, parent_id, branch, active, role, content, created_at,
+            trans_id, latency_ms, knowledge_search_ms, llm_ms, db_ms
+        )
+        VALUES (?, ?, ?, 1, ?, ?, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?)
+        RETURNING id, created_at, revision`
+
+	msg.Active = true
+	if err := tx.QueryRowContext(ctx, query,
+		msg.ConvID, msg.ParentID, msg.Branch, msg.Role, msg.Content,
+		nullString(msg.TransID), nullInt64(msg.LatencyMS), nullInt64(msg.KnowledgeSearchMS), nullInt64(msg.LLMMS), nullInt64(msg.DBMS),
+	).Scan(&msg.ID, &msg.CreatedAt, &msg.Revision); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// nullString converts "" to a SQL NULL, so optional text fields like
+// Message.TransID don't get stored as an empty string on rows that predate
+// the feature that sets them.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// nullInt64 converts 0 to a SQL NULL, so optional latency fields read back
+// as zero-value (not "measured as zero") when they were never recorded.
+func nullInt64(v int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: v, Valid: v != 0}
+}
+
+// rowQuerier is satisfied by both *sql.DB and *sql.Tx, so message lookups
+// can run either standalone or as part of a larger transaction.
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// getMessageByID loads a single message by ID.
+func getMessageByID(ctx context.Context, q rowQuerier, id int64) (*models.Message, error) {
+	var msg models.Message
+	var parentID sql.NullInt64
+	var transID sql.NullString
+	var latencyMS, knowledgeSearchMS, llmMS, dbMS sql.NullInt64
+	err := q.QueryRowContext(ctx, `
+        SELECT id, conversation_id, parent_id, branch, active, role, content, created_at,
+               trans_id, latency_ms, knowledge_search_ms, llm_ms, db_ms, revision
+        FROM messages
+        WHERE id = ?`, id).Scan(
+		&msg.ID, &msg.ConvID, &parentID, &msg.Branch, &msg.Active, &msg.Role, &msg.Content, &msg.CreatedAt,
+		&transID, &latencyMS, &knowledgeSearchMS, &llmMS, &dbMS, &msg.Revision,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if parentID.Valid {
+		msg.ParentID = &parentID.Int64
+	}
+	msg.TransID = transID.String
+	msg.LatencyMS = latencyMS.Int64
+	msg.KnowledgeSearchMS = knowledgeSearchMS.Int64
+	msg.LLMMS = llmMS.Int64
+	msg.DBMS = dbMS.Int64
+	return &msg, nil
+}
+
+// activeLeafID returns the ID of the message at the end of the
+// conversation's currently selected branch: the active message with no
+// active child. It returns nil if the conversation has no messages yet.
+func activeLeafID(ctx context.Context, q rowQuerier, conversationID int64) (*int64, error) {
+	var id sql.NullInt64
+	err := q.QueryRowContext(ctx, `
+        SELECT id FROM messages
+        WHERE conversation_id = ? AND active = 1
+          AND id NOT IN (
+              SELECT parent_id FROM messages
+              WHERE conversation_id = ? AND active = 1 AND parent_id IS NOT NULL
+          )
+        ORDER BY id DESC
+        LIMIT 1`, conversationID, conversationID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &id.Int64, nil
+}
+
+// CreateConversation starts a new conversation. model selects which
+// configured model preset the conversation uses for every subsequent
+// message; an empty model defers to the llm.Service's default preset.
+func (db *Database) CreateConversation(ctx context.Context, title, model string) (*models.Conversation, error) {
+	return db.CreateConversationWithAgent(ctx, title, model, "")
+}
+
+// CreateConversationWithAgent behaves like CreateConversation, but also
+// assigns the conversation to a registered agent by name, so
+// llm.Service.ProcessMessage scopes that conversation's system prompt and
+// built-in tools down to agentName's AgentDefinition. An empty agentName
+// behaves exactly like CreateConversation.
+func (db *Database) CreateConversationWithAgent(ctx context.Context, title, model, agentName string) (*models.Conversation, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+        INSERT INTO conversations (title, model, agent, created_at)
+        VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+        RETURNING id, created_at, revision`
+
+	conv := &models.Conversation{Title: title, Model: model, Agent: agentName}
+	err := db.db.QueryRowContext(ctx, query, title, model, agentName).Scan(&conv.ID, &conv.CreatedAt, &conv.Revision)
+	return conv, err
+}
+
+// GetConversation returns a single conversation by ID.
+func (db *Database) GetConversation(ctx context.Context, id int64) (*models.Conversation, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var conv models.Conversation
+	var model, agentName sql.NullString
+	err := db.db.QueryRowContext(ctx, `
+        SELECT id, title, model, agent, created_at, revision
+        FROM conversations
+        WHERE id = ?`, id).Scan(&conv.ID, &conv.Title, &model, &agentName, &conv.CreatedAt, &conv.Revision)
+	if err != nil {
+		return nil, err
+	}
+	conv.Model = model.String
+	conv.Agent = agentName.String
+	return &conv, nil
+}
+
+// SaveToKnowledgeBase stores content as a new knowledge row and, if db has
+// an embedder configured, computes and stores its embedding.
+func (db *Database) SaveToKnowledgeBase(ctx context.Context, content string, conversationID int64) error {
+	id, err := db.insertKnowledgeRow(ctx, content, conversationID)
+	if err != nil {
+		return err
+	}
+
+	if db.embedder == nil {
+		return nil
+	}
+
+	// Populate the embedding outside the main transaction: the knowledge
+	// entry is already committed, and a failure here shouldn't be reported
+	// as a failed save. SearchKnowledge still surfaces the row via FTS, and
+	// ReindexKnowledgeEmbeddings can backfill the vector later. This uses the
+	// caller's ctx, so a canceled request aborts the embed call too, rather
+	// than leaking it to run past the request's lifetime.
+	if err := db.embedRow(ctx, id, content); err != nil {
+		fmt.Printf("Warning: failed to embed knowledge row %d: %v\n", id, err)
+	}
+	return nil
+}
+
+// insertKnowledgeRow inserts content into knowledge and returns the new
+// row's ID. The knowledge_ai trigger populates knowledge_fts from this
+// insert; inserting into knowledge_fts here too would collide with it on
+// the same docid.
+func (db *Database) insertKnowledgeRow(ctx context.Context, content string, conversationID int64) (int64, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO knowledge (content, conversation_id, created_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP)
+	`, content, conversationID)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// UpdateKnowledge replaces knowledge row id's content, bumping its revision,
+// as long as its stored revision matches expectedRev. A mismatch (someone
+// else edited it first) returns core.ErrRevisionConflict; a nonexistent id
+// returns sql.ErrNoRows. The knowledge_au trigger keeps knowledge_fts in
+// sync; if db has an embedder configured, its stored embedding is
+// recomputed the same way SaveToKnowledgeBase populates a new row's.
+func (db *Database) UpdateKnowledge(ctx context.Context, id int64, content string, expectedRev int64) (int64, error) {
+	newRev, err := db.updateKnowledgeRow(ctx, id, content, expectedRev)
+	if err != nil {
+		return 0, err
+	}
+
+	if db.embedder != nil {
+		if err := db.embedRow(ctx, id, content); err != nil {
+			fmt.Printf("Warning: failed to re-embed knowledge row %d: %v\n", id, err)
+		}
+	}
+	return newRev, nil
+}
+
+// updateKnowledgeRow is UpdateKnowledge's DB-only half, split out so it can
+// be individually timeout-wrapped without bounding the embedder call.
+func (db *Database) updateKnowledgeRow(ctx context.Context, id int64, content string, expectedRev int64) (int64, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var newRev int64
+	err := db.db.QueryRowContext(ctx, `
+        UPDATE knowledge SET content = ?, revision = revision + 1
+        WHERE id = ? AND revision = ?
+        RETURNING revision`, content, id, expectedRev).Scan(&newRev)
+	if err == sql.ErrNoRows {
+		return 0, conflictOrNotFound(ctx, db.db, "knowledge", id)
+	}
+	return newRev, err
+}
+
+// embedRow computes and stores the embedding for a single knowledge row.
+func (db *Database) embedRow(ctx context.Context, knowledgeID int64, content string) error {
+	vecs, err := db.embedder.Embed(ctx, []string{content})
+	if err != nil {
+		return err
+	}
+	if len(vecs) == 0 {
+		return fmt.Errorf("embedder returned no vectors")
+	}
+	return db.storeEmbedding(ctx, knowledgeID, vecs[0], db.embedderModel())
+}
+
+// storeEmbedding persists a single knowledge row's embedding, bounded by
+// db's per-query timeout.
+func (db *Database) storeEmbedding(ctx context.Context, knowledgeID int64, vec []float32, model string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.db.ExecContext(ctx, `
+		INSERT OR REPLACE INTO knowledge_embeddings (knowledge_id, dim, vec, model)
+		VALUES (?, ?, ?, ?)
+	`, knowledgeID, len(vec), encodeVector(vec), nullString(model))
+	return err
+}
+
+// HasEmbedder reports whether db was opened with an embedder configured.
+// HybridSearch requires one; SearchKnowledge and ReindexKnowledgeEmbeddings
+// degrade gracefully without it.
+func (db *Database) HasEmbedder() bool {
+	return db.embedder != nil
+}
+
+// embedderModel returns the configured embedder's model name, or "" if it's
+// nil or doesn't implement embeddings.ModelNamer.
+func (db *Database) embedderModel() string {
+	namer, ok := db.embedder.(embeddings.ModelNamer)
+	if !ok {
+		return ""
+	}
+	return namer.Model()
+}
+
+// encodeVector packs a float32 vector as little-endian bytes for storage in
+// the knowledge_embeddings BLOB column.
+func encodeVector(vec []float32) []byte {
+	buf := make([]byte, 4*len(vec))
+	for i, v := range vec {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(v))
+	}
+	return buf
+}
+
+// decodeVector is the inverse of encodeVector.
+func decodeVector(buf []byte) []float32 {
+	vec := make([]float32, len(buf)/4)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:]))
+	}
+	return vec
+}
+
+// GetConversationHistory returns up to limit messages from the conversation's
+// currently active branch, newest first. Rather than reading every row in
+// created_at order, it starts at the active leaf and walks parent_id
+// pointers back to the root in a single recursive query, so a conversation
+// with edited/abandoned branches only returns the path that's actually
+// selected. limit <= 0 means no limit.
+func (db *Database) GetConversationHistory(ctx context.Context, conversationID int64, limit int) ([]models.Message, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	leafID, err := activeLeafID(ctx, db.db, conversationID)
+	if err != nil {
+		return []models.Message{}, fmt.Errorf("failed to find active leaf: %w", err)
+	}
+	if leafID == nil {
+		return []models.Message{}, nil
+	}
+
+	sqlLimit := limit
+	if sqlLimit <= 0 {
+		sqlLimit = -1 // SQLite treats a negative LIMIT as unbounded.
+	}
+
+	rows, err := db.db.QueryContext(ctx, `
+        WITH RECURSIVE chain(id, conversation_id, parent_id, branch, active, role, content, created_at,
+                              trans_id, latency_ms, knowledge_search_ms, llm_ms, db_ms, revision, depth) AS (
+            SELECT id, conversation_id, parent_id, branch, active, role, content, created_at,
+                   trans_id, latency_ms, knowledge_search_ms, llm_ms, db_ms, revision, 0
+            FROM messages WHERE id = ?
+            UNION ALL
+            SELECT m.id, m.conversation_id, m.parent_id, m.branch, m.active, m.role, m.content, m.created_at,
+                   m.trans_id, m.latency_ms, m.knowledge_search_ms, m.llm_ms, m.db_ms, m.revision, chain.depth + 1
+            FROM messages m
+            JOIN chain ON m.id = chain.parent_id
+        )
+        SELECT id, conversation_id, parent_id, branch, active, role, content, created_at,
+               trans_id, latency_ms, knowledge_search_ms, llm_ms, db_ms, revision
+        FROM chain
+        ORDER BY depth
+        LIMIT ?`, *leafID, sqlLimit)
+	if err != nil {
+		return []models.Message{}, fmt.Errorf("failed to walk message chain: %w", err)
+	}
+	defer rows.Close()
+
+	messages := make([]models.Message, 0)
+	for rows.Next() {
+		var msg models.Message
+		var parentID sql.NullInt64
+		var transID sql.NullString
+		var latencyMS, knowledgeSearchMS, llmMS, dbMS sql.NullInt64
+		if err := rows.Scan(
+			&msg.ID, &msg.ConvID, &parentID, &msg.Branch, &msg.Active, &msg.Role, &msg.Content, &msg.CreatedAt,
+			&transID, &latencyMS, &knowledgeSearchMS, &llmMS, &dbMS, &msg.Revision,
+		); err != nil {
+			return []models.Message{}, err
+		}
+		if parentID.Valid {
+			msg.ParentID = &parentID.Int64
+		}
+		msg.TransID = transID.String
+		msg.LatencyMS = latencyMS.Int64
+		msg.KnowledgeSearchMS = knowledgeSearchMS.Int64
+		msg.LLMMS = llmMS.Int64
+		msg.DBMS = dbMS.Int64
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// historyPageCursorZeros pads created_at's unix-millisecond value out to a
+// fixed 20 digits before the substr in the cursor expression below, the same
+// way status-go's cursor pagination does: long enough that no value this
+// database will ever store overflows it.
+const historyPageCursorZeros = "00000000000000000000"
+
+// GetConversationHistoryPage returns up to limit messages from
+// conversationID's active branch, most recent first, for cursor-based paging
+// through long histories. Pass cursor "" for the first (most recent) page;
+// thereafter pass the previous call's nextCursor to continue further into
+// the past. nextCursor is "" when the page holds fewer than limit messages;
+// a full page always carries a cursor, even if it happens to end at the
+// chain's start, in which case the next call returns no messages.
+//
+// Unlike GetConversationHistory's plain LIMIT (which pages unreliably when
+// messages share a created_at timestamp, as happens with fast LLM streams),
+// the cursor is a string combining created_at (as milliseconds since the
+// epoch, zero-padded to 20 digits) and the message id (also zero-padded, so
+// id 10 doesn't sort before id 9 as a string), so "cursor < ?" stays a
+// stable, gap-free WHERE clause even across ties.
+func (db *Database) GetConversationHistoryPage(ctx context.Context, conversationID int64, cursor string, limit int) ([]models.Message, string, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	leafID, err := activeLeafID(ctx, db.db, conversationID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to find active leaf: %w", err)
+	}
+	if leafID == nil {
+		return nil, "", nil
+	}
+	if limit <= 0 {
+		return nil, "", nil
+	}
+
+	rows, err := db.db.QueryContext(ctx, `
+        WITH RECURSIVE chain(id, conversation_id, parent_id, branch, active, role, content, created_at,
+                              trans_id, latency_ms, knowledge_search_ms, llm_ms, db_ms, revision) AS (
+            SELECT id, conversation_id, parent_id, branch, active, role, content, created_at,
+                   trans_id, latency_ms, knowledge_search_ms, llm_ms, db_ms, revision
+            FROM messages WHERE id = ?
+            UNION ALL
+            SELECT m.id, m.conversation_id, m.parent_id, m.branch, m.active, m.role, m.content, m.created_at,
+                   m.trans_id, m.latency_ms, m.knowledge_search_ms, m.llm_ms, m.db_ms, m.revision
+            FROM messages m
+            JOIN chain ON m.id = chain.parent_id
+        ),
+        cursored AS (
+            SELECT *,
+                   substr(? || (CAST(strftime('%s', created_at) AS INTEGER) * 1000), -20, 20) || printf('%020d', id) AS cursor
+            FROM chain
+        )
+        SELECT id, conversation_id, parent_id, branch, active, role, content, created_at,
+               trans_id, latency_ms, knowledge_search_ms, llm_ms, db_ms, revision, cursor
+        FROM cursored
+        WHERE ? = '' OR cursor < ?
+        ORDER BY cursor DESC
+        LIMIT ?`, *leafID, historyPageCursorZeros, cursor, cursor, limit)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to walk message chain: %w", err)
+	}
+	defer rows.Close()
+
+	messages := make([]models.Message, 0)
+	var nextCursor string
+	for rows.Next() {
+		var msg models.Message
+		var parentID sql.NullInt64
+		var transID sql.NullString
+		var latencyMS, knowledgeSearchMS, llmMS, dbMS sql.NullInt64
+		if err := rows.Scan(
+			&msg.ID, &msg.ConvID, &parentID, &msg.Branch, &msg.Active, &msg.Role, &msg.Content, &msg.CreatedAt,
+			&transID, &latencyMS, &knowledgeSearchMS, &llmMS, &dbMS, &msg.Revision, &nextCursor,
+		); err != nil {
+			return nil, "", err
+		}
+		if parentID.Valid {
+			msg.ParentID = &parentID.Int64
+		}
+		msg.TransID = transID.String
+		msg.LatencyMS = latencyMS.Int64
+		msg.KnowledgeSearchMS = knowledgeSearchMS.Int64
+		msg.LLMMS = llmMS.Int64
+		msg.DBMS = dbMS.Int64
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	// Fewer rows than asked for means the chain's start was reached; there's
+	// no further, older page to fetch.
+	if len(messages) < limit {
+		nextCursor = ""
+	}
+	return messages, nextCursor, nil
+}
+
+// EditMessage replaces id with a new sibling message holding content: same
+// parent, a freshly allocated branch id. The old message and everything that
+// was ever replied to it are deactivated (not deleted), so they're still
+// reachable via GetConversationTree / SelectBranch, but GetConversationHistory
+// and the next reply will follow the new branch instead.
+//
+// expectedRev guards against editing a message that's changed since the
+// caller last saw it (e.g. a concurrent edit from another open tab): if
+// original's stored revision doesn't match, this returns
+// core.ErrRevisionConflict without touching anything. The new message
+// created by the edit always starts at revision 0, same as any other freshly
+// inserted message.
+func (db *Database) EditMessage(ctx context.Context, id int64, content, transID string, expectedRev int64) (*models.Message, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	original, err := getMessageByID(ctx, tx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load message %d: %w", id, err)
+	}
+
+	// Bumping original's revision here (rather than just comparing it to
+	// expectedRev) means a second edit of the same message, racing this one,
+	// sees the bumped value and correctly reports a conflict instead of
+	// silently creating a sibling branch from under it.
+	res, err := tx.ExecContext(ctx, `
+        UPDATE messages SET revision = revision + 1 WHERE id = ? AND revision = ?`, id, expectedRev)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check message revision: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, core.ErrRevisionConflict
+	}
+
+	var nextBranch int64
+	if err := tx.QueryRowContext(ctx, `
+        SELECT COALESCE(MAX(branch), 0) + 1 FROM messages
+        WHERE conversation_id = ? AND parent_id IS ?`,
+		original.ConvID, original.ParentID).Scan(&nextBranch); err != nil {
+		return nil, fmt.Errorf("failed to allocate branch id: %w", err)
+	}
+
+	edited := &models.Message{
+		ConvID:   original.ConvID,
+		ParentID: original.ParentID,
+		Branch:   nextBranch,
+		Active:   true,
+		Role:     original.Role,
+		Content:  content,
+		TransID:  transID,
+	}
+	if err := tx.QueryRowContext(ctx, `
+        INSERT INTO messages (conversation_id, parent_id, branch, active, role, content, created_at, trans_id)
+        VALUES (?, ?, ?, 1, ?, ?, CURRENT_TIMESTAMP, ?)
+        RETURNING id, created_at`,
+		edited.ConvID, edited.ParentID, edited.Branch, edited.Role, edited.Content, nullString(edited.TransID),
+	).Scan(&edited.ID, &edited.CreatedAt); err != nil {
+		return nil, fmt.Errorf("failed to insert edited message: %w", err)
+	}
+
+	// Truncate the old reply chain below the edited message, and make the
+	// new one active all the way up to the root, even if id itself was on an
+	// already-inactive branch (editing a message reachable only via the
+	// conversation tree view, not the current active path).
+	if err := deactivateSubtree(ctx, tx, id); err != nil {
+		return nil, fmt.Errorf("failed to deactivate replaced branch: %w", err)
+	}
+	if err := activatePath(ctx, tx, edited.ID); err != nil {
+		return nil, fmt.Errorf("failed to activate edited branch: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return edited, nil
+}
+
+// deactivateSubtree sets active = 0 on id and every descendant reachable
+// through parent_id, so an edited or abandoned branch stops showing up in
+// GetConversationHistory while staying in the database for SelectBranch to
+// restore later.
+func deactivateSubtree(ctx context.Context, tx *sql.Tx, rootID int64) error {
+	queue := []int64{rootID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		if _, err := tx.ExecContext(ctx, `UPDATE messages SET active = 0 WHERE id = ?`, id); err != nil {
+			return err
+		}
+
+		rows, err := tx.QueryContext(ctx, `SELECT id FROM messages WHERE parent_id = ?`, id)
+		if err != nil {
+			return err
+		}
+		var children []int64
+		for rows.Next() {
+			var childID int64
+			if err := rows.Scan(&childID); err != nil {
+				rows.Close()
+				return err
+			}
+			children = append(children, childID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		queue = append(queue, children...)
+	}
+	return nil
+}
+
+// deactivateSiblingSubtrees deactivates every message sharing parentID as
+// their parent within conversation convID, except exceptID, along with each
+// of those siblings' own descendants. Used whenever a branch at a given fork
+// becomes active, so an old sibling branch's descendants don't linger with
+// active = 1 and get mistaken for the conversation's active leaf.
+func deactivateSiblingSubtrees(ctx context.Context, tx *sql.Tx, convID int64, parentID *int64, exceptID int64) error {
+	rows, err := tx.QueryContext(ctx, `
+        SELECT id FROM messages
+        WHERE conversation_id = ? AND parent_id IS ? AND id != ?`, convID, parentID, exceptID)
+	if err != nil {
+		return err
+	}
+	var siblings []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		siblings = append(siblings, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, sid := range siblings {
+		if err := deactivateSubtree(ctx, tx, sid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// activatePath marks id and every ancestor up to the conversation root as
+// active, deactivating whichever sibling subtree was active at each fork
+// along the way. Used by both SelectBranch and EditMessage so a newly
+// selected or edited message becomes reachable from
+// GetConversationHistory's leaf-to-root walk; whatever was already active
+// beneath id, if anything, is left untouched.
+func activatePath(ctx context.Context, tx *sql.Tx, id int64) error {
+	currentID := &id
+	for currentID != nil {
+		msg, err := getMessageByID(ctx, tx, *currentID)
+		if err != nil {
+			return fmt.Errorf("failed to load message %d: %w", *currentID, err)
+		}
+
+		if err := deactivateSiblingSubtrees(ctx, tx, msg.ConvID, msg.ParentID, msg.ID); err != nil {
+			return fmt.Errorf("failed to deactivate sibling branches: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE messages SET active = 1 WHERE id = ?`, msg.ID); err != nil {
+			return fmt.Errorf("failed to activate message %d: %w", msg.ID, err)
+		}
+
+		currentID = msg.ParentID
+	}
+	return nil
+}
+
+// SelectBranch marks id's branch active, restoring the path from the
+// conversation root down to id as the one GetConversationHistory returns.
+func (db *Database) SelectBranch(ctx context.Context, id int64) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := activatePath(ctx, tx, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetConversationTree returns every message in the conversation, active or
+// not, ordered by id so a client can reconstruct the full branch DAG from
+// each message's parent_id.
+func (db *Database) GetConversationTree(ctx context.Context, conversationID int64) ([]models.Message, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.db.QueryContext(ctx, `
+        SELECT id, conversation_id, parent_id, branch, active, role, content, created_at,
+               trans_id, latency_ms, knowledge_search_ms, llm_ms, db_ms, revision
+        FROM messages
+        WHERE conversation_id = ?
+        ORDER BY id`, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conversation tree: %w", err)
+	}
+	defer rows.Close()
+
+	messages := make([]models.Message, 0)
+	for rows.Next() {
+		var msg models.Message
+		var parentID sql.NullInt64
+		var transID sql.NullString
+		var latencyMS, knowledgeSearchMS, llmMS, dbMS sql.NullInt64
+		if err := rows.Scan(
+			&msg.ID, &msg.ConvID, &parentID, &msg.Branch, &msg.Active, &msg.Role, &msg.Content, &msg.CreatedAt,
+			&transID, &latencyMS, &knowledgeSearchMS, &llmMS, &dbMS, &msg.Revision,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		if parentID.Valid {
+			msg.ParentID = &parentID.Int64
+		}
+		msg.TransID = transID.String
+		msg.LatencyMS = latencyMS.Int64
+		msg.KnowledgeSearchMS = knowledgeSearchMS.Int64
+		msg.LLMMS = llmMS.Int64
+		msg.DBMS = dbMS.Int64
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+func (db *Database) GetConversations(ctx context.Context) ([]models.Conversation, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+        SELECT id, title, model, agent, created_at, revision
+        FROM conversations
+        ORDER BY created_at DESC`
+
+	rows, err := db.db.QueryContext(ctx, query)
+	if err != nil {
+		return []models.Conversation{}, err
+	}
+	defer rows.Close()
+
+	conversations := make([]models.Conversation, 0)
+	for rows.Next() {
+		var conv models.Conversation
+		var model, agentName sql.NullString
+		err := rows.Scan(&conv.ID, &conv.Title, &model, &agentName, &conv.CreatedAt, &conv.Revision)
+		if err != nil {
+			return []models.Conversation{}, err
+		}
+		conv.Model = model.String
+		conv.Agent = agentName.String
+		conversations = append(conversations, conv)
+	}
+	return conversations, nil
+}
+
+// ftsCandidates returns up to searchCandidatePoolSize knowledge rows whose
+// FTS index matches query, ranked by lexicalRankScore (ties broken by
+// recency). It also syncs the FTS table against knowledge for any row the
+// knowledge_ai trigger missed (e.g. rows inserted before the trigger
+// existed), so a stale index can't hide matches.
+func (db *Database) ftsCandidates(ctx context.Context, query string) ([]core.KnowledgeResult, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	const syncFTS = `
+	INSERT INTO knowledge_fts(docid, content, conversation_id)
+	SELECT id, content, conversation_id
+	FROM knowledge k
+	WHERE NOT EXISTS (
+		SELECT 1 FROM knowledge_fts f
+		WHERE f.docid = k.id
+	);`
+	if _, err := db.db.ExecContext(ctx, syncFTS); err != nil {
+		return nil, fmt.Errorf("failed to sync FTS table: %w", err)
+	}
+
+	// The candidate pool is capped well above any realistic topK so
+	// downstream re-ranking stays cheap even on a knowledge base with
+	// thousands of rows matching a common query.
+	rows, err := db.db.QueryContext(ctx, `
+		SELECT k.id, k.content, k.conversation_id, k.created_at, k.revision
+		FROM knowledge k
+		JOIN knowledge_fts fts ON k.id = fts.docid
+		WHERE fts.content MATCH ?
+		ORDER BY k.created_at DESC
+		LIMIT ?;
+	`, query, searchCandidatePoolSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search knowledge: %w", err)
+	}
+	defer rows.Close()
+
+	var results []core.KnowledgeResult
+	for rows.Next() {
+		var result core.KnowledgeResult
+		if err := rows.Scan(&result.ID, &result.Content, &result.ConversationID, &result.CreatedAt, &result.Revision); err != nil {
+			return nil, fmt.Errorf("failed to scan result: %w", err)
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read search results: %w", err)
+	}
+
+	type scored struct {
+		result core.KnowledgeResult
+		score  int
+	}
+	withScores := make([]scored, len(results))
+	for i, r := range results {
+		withScores[i] = scored{result: r, score: lexicalRankScore(query, r.Content)}
+	}
+	sort.SliceStable(withScores, func(i, j int) bool {
+		return withScores[i].score > withScores[j].score
+	})
+	for i, s := range withScores {
+		results[i] = s.result
+	}
+	return results, nil
+}
+
+// lexicalRankScore counts how many distinct whitespace-separated terms of
+// query appear in content, case-insensitively. FTS4, unlike FTS5, has no
+// built-in bm25()-style ranking function, so this is ftsCandidates' stand-in
+// for match quality: good enough to tell a strong keyword match from a weak
+// one without pulling in a real ranking extension.
+func lexicalRankScore(query, content string) int {
+	content = strings.ToLower(content)
+	score := 0
+	for _, term := range strings.Fields(strings.ToLower(query)) {
+		if strings.Contains(content, term) {
+			score++
+		}
+	}
+	return score
+}
+
+// SearchKnowledge returns up to topK knowledge rows relevant to query. It
+// pre-filters candidates with an FTS4 MATCH query, then, if db has an
+// embedder configured, re-ranks those candidates by cosine similarity to the
+// query embedding and drops any scoring below minScore. Without an embedder
+// it returns the FTS candidates as-is, ranked by ftsCandidates' term-overlap
+// score, and minScore is ignored.
+// SearchKnowledge's own DB reads (ftsCandidates, knowledgeVectors) are each
+// individually bounded by db's per-query timeout; the similarity-ranking
+// call to the embedder below is a network call to an external service and is
+// deliberately left bounded only by ctx itself, so a slow embedder can't be
+// mistaken for a stuck SQLite query.
+func (db *Database) SearchKnowledge(ctx context.Context, query string, topK int, minScore float64) ([]core.KnowledgeResult, error) {
+	results, err := db.ftsCandidates(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if db.embedder == nil {
+		if topK > 0 && len(results) > topK {
+			results = results[:topK]
+		}
+		return results, nil
+	}
+
+	ids := make([]int64, len(results))
+	for i, result := range results {
+		ids[i] = result.ID
+	}
+	vectors, err := db.knowledgeVectors(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load knowledge embeddings: %w", err)
+	}
+
+	// Rows without an embedding yet (e.g. awaiting a reindex) can't be
+	// similarity-ranked, but they're still real FTS matches, so they're kept
+	// and appended after the ranked ones rather than dropped.
+	var candidates []embeddings.Candidate
+	var unranked []core.KnowledgeResult
+	byID := make(map[int64]core.KnowledgeResult, len(results))
+	for _, result := range results {
+		byID[result.ID] = result
+		if vec, ok := vectors[result.ID]; ok {
+			candidates = append(candidates, embeddings.Candidate{ID: result.ID, Content: result.Content, Vec: vec})
+		} else {
+			unranked = append(unranked, result)
+		}
+	}
+
+	retriever := embeddings.NewRetriever(db.embedder)
+	scored, err := retriever.Retrieve(ctx, query, candidates, 0, minScore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank knowledge by similarity: %w", err)
+	}
+
+	ranked := make([]core.KnowledgeResult, 0, len(scored)+len(unranked))
+	for _, s := range scored {
+		result := byID[s.ID]
+		result.Score = s.Score
+		ranked = append(ranked, result)
+	}
+	ranked = append(ranked, unranked...)
+	if topK > 0 && len(ranked) > topK {
+		ranked = ranked[:topK]
+	}
+	return ranked, nil
+}
+
+// searchCandidatePoolSize bounds how many FTS matches SearchKnowledge pulls
+// in before similarity-ranking, so a common query can't force it to load and
+// score embeddings for the entire knowledge table.
+const searchCandidatePoolSize = 200
+
+// knowledgeVectors loads the stored embeddings for ids in a single query,
+// keyed by knowledge ID. IDs with no embedding yet are simply absent from
+// the result.
+func (db *Database) knowledgeVectors(ctx context.Context, ids []int64) (map[int64][]float32, error) {
+	vectors := make(map[int64][]float32, len(ids))
+	if len(ids) == 0 {
+		return vectors, nil
+	}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	placeholders := make([]string, len(ids))
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+
+	query := fmt.Sprintf(
+		`SELECT knowledge_id, vec FROM knowledge_embeddings WHERE knowledge_id IN (%s)`,
+		strings.Join(placeholders, ","),
+	)
+	rows, err := db.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var buf []byte
+		if err := rows.Scan(&id, &buf); err != nil {
+			return nil, err
+		}
+		vectors[id] = decodeVector(buf)
+	}
+	return vectors, rows.Err()
+}
+
+// rrfK is the rank-damping constant in HybridSearch's reciprocal rank fusion
+// formula, score(d) = sum_i 1/(rrfK + rank_i(d)). 60 is the value from the
+// original RRF paper and is what most hybrid-search implementations default
+// to; it's conservative enough that a single ranker's placement at rank 1
+// doesn't overwhelm the other ranker's opinion.
+const rrfK = 60
+
+// HybridSearch returns up to k knowledge rows relevant to query, ranked by
+// reciprocal rank fusion between an FTS4 lexical ranking and an embedding
+// cosine-similarity ranking: score(d) = alpha/(rrfK+rankFTS(d)) +
+// (1-alpha)/(rrfK+rankSemantic(d)), with either term dropped for a row that
+// ranker didn't surface at all. alpha=1 is FTS-only, alpha=0 is
+// semantic-only, and 0.5 weights the two evenly. Unlike SearchKnowledge,
+// which only re-ranks FTS matches, the semantic side here is pulled from its
+// own candidate pool (semanticCandidatePool, capped the same way as
+// ftsCandidates), so a semantically close row with no shared keywords can
+// still surface even though it was never an FTS match. Requires an embedder.
+// Like SearchKnowledge, its own DB reads (ftsCandidates, semanticCandidatePool)
+// are each individually bounded by db's per-query timeout, while the
+// embedder call is left bounded only by ctx itself.
+func (db *Database) HybridSearch(ctx context.Context, query string, k int, alpha float64) ([]core.KnowledgeResult, error) {
+	if db.embedder == nil {
+		return nil, fmt.Errorf("hybrid search requires an embedder, but this database was opened without one")
+	}
+
+	lexical, err := db.ftsCandidates(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	semanticPool, err := db.semanticCandidatePool(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load knowledge embeddings: %w", err)
+	}
+	candidates := make([]embeddings.Candidate, len(semanticPool))
+	for i, r := range semanticPool {
+		candidates[i] = embeddings.Candidate{ID: r.ID, Content: r.Content, Vec: r.vec}
+	}
+	retriever := embeddings.NewRetriever(db.embedder)
+	semantic, err := retriever.Retrieve(ctx, query, candidates, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank knowledge by similarity: %w", err)
+	}
+
+	byID := make(map[int64]core.KnowledgeResult, len(lexical)+len(semanticPool))
+	fused := make(map[int64]float64, len(lexical)+len(semanticPool))
+	for rank, r := range lexical {
+		byID[r.ID] = r
+		fused[r.ID] += alpha * rrfScore(rank)
+	}
+	semByID := make(map[int64]core.KnowledgeResult, len(semanticPool))
+	for _, r := range semanticPool {
+		semByID[r.ID] = r.KnowledgeResult
+	}
+	for rank, s := range semantic {
+		if _, ok := byID[s.ID]; !ok {
+			byID[s.ID] = semByID[s.ID]
+		}
+		fused[s.ID] += (1 - alpha) * rrfScore(rank)
+	}
+
+	ranked := make([]core.KnowledgeResult, 0, len(byID))
+	for id, result := range byID {
+		result.Score = fused[id]
+		ranked = append(ranked, result)
+	}
+	sort.Slice(ranked, func(i, j int) bool { return ranked[i].Score > ranked[j].Score })
+	if k > 0 && len(ranked) > k {
+		ranked = ranked[:k]
+	}
+	return ranked, nil
+}
+
+// rrfScore converts a 0-based rank into its reciprocal-rank-fusion term.
+func rrfScore(rank int) float64 {
+	return 1 / float64(rrfK+rank+1)
+}
+
+// knowledgeCandidate is a knowledge row paired with its stored embedding, for
+// HybridSearch's semantic ranking pool.
+type knowledgeCandidate struct {
+	core.KnowledgeResult
+	vec []float32
+}
+
+// semanticCandidatePool returns up to searchCandidatePoolSize knowledge rows
+// that have a stored embedding, most recent first, independent of any FTS
+// match — this is what lets HybridSearch surface a semantically close row
+// that shares no keywords with query.
+func (db *Database) semanticCandidatePool(ctx context.Context) ([]knowledgeCandidate, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.db.QueryContext(ctx, `
+		SELECT k.id, k.content, k.conversation_id, k.created_at, k.revision, e.vec
+		FROM knowledge k
+		JOIN knowledge_embeddings e ON e.knowledge_id = k.id
+		ORDER BY k.created_at DESC
+		LIMIT ?;
+	`, searchCandidatePoolSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pool []knowledgeCandidate
+	for rows.Next() {
+		var c knowledgeCandidate
+		var buf []byte
+		if err := rows.Scan(&c.ID, &c.Content, &c.ConversationID, &c.CreatedAt, &c.Revision, &buf); err != nil {
+			return nil, err
+		}
+		c.vec = decodeVector(buf)
+		pool = append(pool, c)
+	}
+	return pool, rows.Err()
+}
+
+// reindexBatchSize bounds how many knowledge rows ReindexKnowledgeEmbeddings
+// sends to the embedder in a single Embed call, so backfilling a large
+// knowledge base doesn't require one round trip per row.
+const reindexBatchSize = 16
+
+// knowledgeRow is a knowledge row awaiting an embedding.
+type knowledgeRow struct {
+	id      int64
+	content string
+}
+
+// pendingKnowledgeRows returns every knowledge row without a stored
+// embedding yet, bounded by db's per-query timeout.
+func (db *Database) pendingKnowledgeRows(ctx context.Context) ([]knowledgeRow, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.db.QueryContext(ctx, `
+		SELECT k.id, k.content
+		FROM knowledge k
+		WHERE NOT EXISTS (
+			SELECT 1 FROM knowledge_embeddings e WHERE e.knowledge_id = k.id
+		);`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find unembedded knowledge rows: %w", err)
+	}
+	defer rows.Close()
+
+	var pending []knowledgeRow
+	for rows.Next() {
+		var r knowledgeRow
+		if err := rows.Scan(&r.id, &r.content); err != nil {
+			return nil, fmt.Errorf("failed to scan knowledge row: %w", err)
+		}
+		pending = append(pending, r)
+	}
+	return pending, rows.Err()
+}
+
+// ReindexKnowledgeEmbeddings backfills knowledge_embeddings for every
+// knowledge row that doesn't have one yet, such as rows written before an
+// embedder was configured, embedding reindexBatchSize rows per call. It is a
+// no-op if db has no embedder. Unlike most Database methods, it doesn't wrap
+// its whole run in a single per-query timeout: backfilling a large knowledge
+// base can take far longer than one query, so only the individual queries
+// and embedder calls it makes along the way are bounded.
+func (db *Database) ReindexKnowledgeEmbeddings(ctx context.Context) (int, error) {
+	if db.embedder == nil {
+		return 0, nil
+	}
+
+	pending, err := db.pendingKnowledgeRows(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for start := 0; start < len(pending); start += reindexBatchSize {
+		end := start + reindexBatchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		batch := pending[start:end]
+
+		texts := make([]string, len(batch))
+		for i, r := range batch {
+			texts[i] = r.content
+		}
+		vecs, err := db.embedder.Embed(ctx, texts)
+		if err != nil {
+			return 0, fmt.Errorf("failed to embed knowledge rows %d-%d: %w", batch[0].id, batch[len(batch)-1].id, err)
+		}
+		if len(vecs) != len(batch) {
+			return 0, fmt.Errorf("embedder returned %d vectors for a batch of %d rows", len(vecs), len(batch))
+		}
+
+		model := db.embedderModel()
+		for i, r := range batch {
+			if err := db.storeEmbedding(ctx, r.id, vecs[i], model); err != nil {
+				return 0, fmt.Errorf("failed to store embedding for knowledge row %d: %w", r.id, err)
+			}
+		}
+	}
+	return len(pending), nil
+}
+
+func (db *Database) DeleteConversation(ctx context.Context, id int64) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Delete messages
+	if _, err := tx.ExecContext(ctx, "DELETE FROM messages WHERE conversation_id = ?", id); err != nil {
+		return err
+	}
+
+	// Delete knowledge entries
+	if _, err := tx.ExecContext(ctx, "DELETE FROM knowledge WHERE conversation_id = ?", id); err != nil {
+		return err
+	}
+
+	// Delete conversation
+	if _, err := tx.ExecContext(ctx, "DELETE FROM conversations WHERE id = ?", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateConversationTitle renames conversation id, bumping its revision, as
+// long as its stored revision matches expectedRev. A mismatch (someone else
+// renamed it first) returns core.ErrRevisionConflict; a nonexistent id
+// returns sql.ErrNoRows.
+func (db *Database) UpdateConversationTitle(ctx context.Context, id int64, title string, expectedRev int64) (int64, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var newRev int64
+	err := db.db.QueryRowContext(ctx, `
+        UPDATE conversations SET title = ?, revision = revision + 1
+        WHERE id = ? AND revision = ?
+        RETURNING revision`, title, id, expectedRev).Scan(&newRev)
+	if err == sql.ErrNoRows {
+		return 0, conflictOrNotFound(ctx, db.db, "conversations", id)
+	}
+	return newRev, err
+}
+
+// conflictOrNotFound figures out why an optimistic-concurrency
+// "UPDATE ... WHERE id = ? AND revision = ?" affected no rows: either id
+// doesn't exist in table at all, or it does but at a different revision than
+// the caller expected. table is always a constant supplied by the caller,
+// never user input.
+func conflictOrNotFound(ctx context.Context, q rowQuerier, table string, id int64) error {
+	var actual int64
+	err := q.QueryRowContext(ctx, fmt.Sprintf(`SELECT revision FROM %s WHERE id = ?`, table), id).Scan(&actual)
+	if err != nil {
+		return err
+	}
+	return core.ErrRevisionConflict
+}
+
+// GetConversationStarters returns the prompt starters cached on convID's
+// conversation row, along with when they were generated. It returns a nil
+// slice and a zero time.Time if nothing has been cached yet.
+func (db *Database) GetConversationStarters(ctx context.Context, convID int64) ([]string, time.Time, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var startersJSON sql.NullString
+	var generatedAt sql.NullTime
+	err := db.db.QueryRowContext(ctx, `
+        SELECT starters, starters_generated_at
+        FROM conversations
+        WHERE id = ?`, convID).Scan(&startersJSON, &generatedAt)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if !startersJSON.Valid {
+		return nil, time.Time{}, nil
+	}
+
+	var starters []string
+	if err := json.Unmarshal([]byte(startersJSON.String), &starters); err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to decode cached starters: %w", err)
+	}
+	return starters, generatedAt.Time, nil
+}
+
+// SaveConversationStarters caches starters on convID's conversation row,
+// stamped with the current time so callers can apply their own TTL.
+func (db *Database) SaveConversationStarters(ctx context.Context, convID int64, starters []string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	startersJSON, err := json.Marshal(starters)
+	if err != nil {
+		return fmt.Errorf("failed to encode starters: %w", err)
+	}
+
+	_, err = db.db.ExecContext(ctx, `
+        UPDATE conversations
+        SET starters = ?, starters_generated_at = CURRENT_TIMESTAMP
+        WHERE id = ?`, string(startersJSON), convID)
+	return err
+}
+
+// CreateAgent registers a new named agent with the given system prompt and
+// the tool names it's allowed to call.
+func (db *Database) CreateAgent(ctx context.Context, name, systemPrompt string, tools []string) (*models.AgentDefinition, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	toolsJSON, err := json.Marshal(tools)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode tools: %w", err)
+	}
+
+	query := `
+        INSERT INTO agents (name, system_prompt, tools, created_at)
+        VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+        RETURNING id, created_at`
+
+	agent := &models.AgentDefinition{Name: name, SystemPrompt: systemPrompt, Tools: tools}
+	if err := db.db.QueryRowContext(ctx, query, name, systemPrompt, string(toolsJSON)).Scan(&agent.ID, &agent.CreatedAt); err != nil {
+		return nil, fmt.Errorf("failed to create agent: %w", err)
+	}
+	return agent, nil
+}
+
+// GetAgents returns every registered agent, most recently created first.
+func (db *Database) GetAgents(ctx context.Context) ([]models.AgentDefinition, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+        SELECT id, name, system_prompt, tools, created_at
+        FROM agents
+        ORDER BY created_at DESC`
+
+	rows, err := db.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query agents: %w", err)
+	}
+	defer rows.Close()
+
+	agents := make([]models.AgentDefinition, 0)
+	for rows.Next() {
+		var agent models.AgentDefinition
+		var toolsJSON string
+		if err := rows.Scan(&agent.ID, &agent.Name, &agent.SystemPrompt, &toolsJSON, &agent.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan agent: %w", err)
+		}
+		if err := json.Unmarshal([]byte(toolsJSON), &agent.Tools); err != nil {
+			return nil, fmt.Errorf("failed to decode tools for agent %q: %w", agent.Name, err)
+		}
+		agents = append(agents, agent)
+	}
+	return agents, nil
+}
+
+// GetAgentByName returns a single registered agent by name.
+func (db *Database) GetAgentByName(ctx context.Context, name string) (*models.AgentDefinition, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var agent models.AgentDefinition
+	var toolsJSON string
+	err := db.db.QueryRowContext(ctx, `
+        SELECT id, name, system_prompt, tools, created_at
+        FROM agents
+        WHERE name = ?`, name).Scan(&agent.ID, &agent.Name, &agent.SystemPrompt, &toolsJSON, &agent.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(toolsJSON), &agent.Tools); err != nil {
+		return nil, fmt.Errorf("failed to decode tools for agent %q: %w", agent.Name, err)
+	}
+	return &agent, nil
+}
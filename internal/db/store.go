@@ -0,0 +1,110 @@
+// Package db defines the storage interface the rest of the app talks to
+// (Store) and a driver registry for picking a backend by DSN scheme, the
+// same way database/sql and its drivers do. Concrete backends live in their
+// own subpackages (internal/db/sqlite, internal/db/postgres) and register
+// themselves via a blank import and an init() calling Register.
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/RichardoC/Pad-i/internal/embeddings"
+	"github.com/RichardoC/Pad-i/internal/models"
+)
+
+// ErrRevisionConflict is returned by Store.UpdateConversationTitle and
+// Store.UpdateKnowledge (and, on backends that offer it, similar
+// revision-checked updates beyond the Store interface, such as
+// internal/db/sqlite's EditMessage) when the row's stored revision doesn't
+// match the caller's expected one: someone else updated it first. Callers
+// that care about safe concurrent edits should reload the row and let the
+// user reconcile, rather than retrying blindly.
+var ErrRevisionConflict = errors.New("db: revision conflict")
+
+// KnowledgeResult is a knowledge row returned by Store.SearchKnowledge (and,
+// on backends that offer it, a hybrid or similarity search beyond the Store
+// interface). Score is backend- and method-specific: a cosine similarity, a
+// fused rank, or 0 if the backend has no ranking signal for the match.
+type KnowledgeResult struct {
+	ID             int64     `json:"id"`
+	Content        string    `json:"content"`
+	ConversationID int64     `json:"conversation_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	Score          float64   `json:"score"`
+	Revision       int64     `json:"revision"` // pass as expectedRev to UpdateKnowledge
+}
+
+// Store is the storage surface every backend must provide: persisting and
+// retrieving conversations, messages, and knowledge. It deliberately doesn't
+// cover every feature the app has (message branching/editing, registered
+// agents, prompt-starter caching, hybrid search) — those remain specific to
+// whichever concrete backend implements them (today, only
+// internal/db/sqlite) until a driver-neutral design for them exists.
+type Store interface {
+	SaveMessage(ctx context.Context, msg *models.Message) error
+	CreateConversation(ctx context.Context, title, model string) (*models.Conversation, error)
+	SaveToKnowledgeBase(ctx context.Context, content string, conversationID int64) error
+	SearchKnowledge(ctx context.Context, query string, topK int, minScore float64) ([]KnowledgeResult, error)
+	GetConversationHistory(ctx context.Context, conversationID int64, limit int) ([]models.Message, error)
+	GetConversations(ctx context.Context) ([]models.Conversation, error)
+	DeleteConversation(ctx context.Context, id int64) error
+
+	// UpdateConversationTitle renames a conversation, bumping its revision,
+	// as long as its stored revision matches expectedRev; otherwise it
+	// returns ErrRevisionConflict. It returns the new revision on success.
+	UpdateConversationTitle(ctx context.Context, id int64, title string, expectedRev int64) (int64, error)
+
+	// UpdateKnowledge replaces a knowledge row's content, bumping its
+	// revision, as long as its stored revision matches expectedRev;
+	// otherwise it returns ErrRevisionConflict. It returns the new revision
+	// on success.
+	UpdateKnowledge(ctx context.Context, id int64, content string, expectedRev int64) (int64, error)
+}
+
+// Opener constructs a Store from a DSN exactly as passed to New, scheme
+// included; each Opener handles the scheme itself (the sqlite Opener trims a
+// sqlite:// prefix to get a file path; the postgres Opener hands the dsn to
+// pgx as-is). Registered by each backend package's init().
+type Opener func(dsn string, embedder embeddings.Embedder) (Store, error)
+
+var drivers = make(map[string]Opener)
+
+// Register associates scheme with opener, so New can dispatch a DSN of that
+// scheme to it. Intended to be called from a backend package's init();
+// registering the same scheme twice panics, the same way database/sql's
+// Register does for a duplicate driver name.
+func Register(scheme string, opener Opener) {
+	if _, ok := drivers[scheme]; ok {
+		panic(fmt.Sprintf("db: Register called twice for scheme %q", scheme))
+	}
+	drivers[scheme] = opener
+}
+
+// New opens a Store for dsn, picking the backend by URL scheme: sqlite:///path
+// or a bare path (for backward compatibility with configs predating this
+// factory) selects internal/db/sqlite; postgres://... or postgresql://...
+// selects internal/db/postgres. embedder may be nil, in which case knowledge
+// is stored without an embedding and SearchKnowledge falls back to whatever
+// the backend's non-semantic ranking is. The backend package must be
+// imported (even if only blank-imported) for its scheme to be registered.
+func New(dsn string, embedder embeddings.Embedder) (Store, error) {
+	scheme := "sqlite"
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse database DSN: %w", err)
+		}
+		scheme = u.Scheme
+	}
+
+	opener, ok := drivers[scheme]
+	if !ok {
+		return nil, fmt.Errorf("unknown database scheme %q (is its backend package imported?)", scheme)
+	}
+	return opener(dsn, embedder)
+}
@@ -0,0 +1,57 @@
+// Package embeddings turns text into vector embeddings and ranks candidate
+// knowledge rows by similarity to a query.
+package embeddings
+
+import (
+	"context"
+
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+// Embedder turns a batch of texts into vector embeddings.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// ModelNamer is implemented by an Embedder that knows the name of the model
+// it calls, so callers that persist vectors alongside their model name (to
+// tell stale vectors from current ones after a model switch) can record it.
+// Optional: an Embedder that doesn't implement it is treated as unnamed.
+type ModelNamer interface {
+	Model() string
+}
+
+// OpenAIEmbedder calls an OpenAI-compatible /v1/embeddings endpoint, which
+// Ollama also exposes for models such as nomic-embed-text.
+type OpenAIEmbedder struct {
+	llm   *openai.LLM
+	model string
+}
+
+// NewOpenAIEmbedder constructs an Embedder that calls baseURL using model as
+// the embedding model name. An empty token defaults to "ollama": Ollama's
+// OpenAI-compatible endpoint doesn't check it, but the openai client refuses
+// to start with an empty one.
+func NewOpenAIEmbedder(baseURL, token, model string) (*OpenAIEmbedder, error) {
+	if token == "" {
+		token = "ollama"
+	}
+	llm, err := openai.New(
+		openai.WithToken(token),
+		openai.WithBaseURL(baseURL),
+		openai.WithEmbeddingModel(model),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &OpenAIEmbedder{llm: llm, model: model}, nil
+}
+
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return e.llm.CreateEmbedding(ctx, texts)
+}
+
+// Model returns the embedding model name passed to NewOpenAIEmbedder.
+func (e *OpenAIEmbedder) Model() string {
+	return e.model
+}
@@ -0,0 +1,83 @@
+package embeddings
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Candidate is a knowledge row eligible for similarity ranking, pre-filtered
+// by the caller (e.g. an FTS query) before its embedding is scored.
+type Candidate struct {
+	ID      int64
+	Content string
+	Vec     []float32
+}
+
+// ScoredCandidate is a Candidate annotated with its cosine similarity to the
+// query vector.
+type ScoredCandidate struct {
+	Candidate
+	Score float64
+}
+
+// Retriever ranks Candidates by embedding similarity to a query.
+type Retriever struct {
+	Embedder Embedder
+}
+
+// NewRetriever constructs a Retriever backed by embedder.
+func NewRetriever(embedder Embedder) *Retriever {
+	return &Retriever{Embedder: embedder}
+}
+
+// Retrieve embeds query, scores each candidate by cosine similarity, and
+// returns the topK candidates scoring at least minScore, highest first.
+func (r *Retriever) Retrieve(ctx context.Context, query string, candidates []Candidate, topK int, minScore float64) ([]ScoredCandidate, error) {
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	vecs, err := r.Embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	if len(vecs) == 0 {
+		return nil, fmt.Errorf("embedder returned no vectors for query")
+	}
+	queryVec := vecs[0]
+
+	scored := make([]ScoredCandidate, 0, len(candidates))
+	for _, c := range candidates {
+		score := CosineSimilarity(queryVec, c.Vec)
+		if score >= minScore {
+			scored = append(scored, ScoredCandidate{Candidate: c, Score: score})
+		}
+	}
+
+	sort.Slice(scored, func(i, j int) bool { return scored[i].Score > scored[j].Score })
+	if topK > 0 && len(scored) > topK {
+		scored = scored[:topK]
+	}
+	return scored, nil
+}
+
+// CosineSimilarity returns the cosine similarity between a and b, or 0 if
+// either vector has zero magnitude or they differ in length.
+func CosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
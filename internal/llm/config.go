@@ -0,0 +1,73 @@
+package llm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ModelPreset is one named entry in models.yaml: which provider backs it,
+// how to reach it, and how large its context window is for history
+// trimming.
+type ModelPreset struct {
+	Name          string `yaml:"name"`
+	Provider      string `yaml:"provider"` // openai, anthropic, googleai, or ollama
+	BaseURL       string `yaml:"base_url"`
+	Model         string `yaml:"model"`
+	APIKeyEnv     string `yaml:"api_key_env"`
+	ContextWindow int    `yaml:"context_window"`
+}
+
+// modelsConfig is the on-disk shape of ~/.config/pad-i/models.yaml.
+type modelsConfig struct {
+	Default string        `yaml:"default"`
+	Models  []ModelPreset `yaml:"models"`
+}
+
+// DefaultConfigPath returns ~/.config/pad-i/models.yaml for the current user.
+func DefaultConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "pad-i", "models.yaml"), nil
+}
+
+// LoadPresets reads model presets from path, returning them alongside the
+// name of the configured default preset. If the config omits "default", the
+// first listed preset becomes the default.
+func LoadPresets(path string) ([]ModelPreset, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read model config %q: %w", path, err)
+	}
+
+	var cfg modelsConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, "", fmt.Errorf("failed to parse model config %q: %w", path, err)
+	}
+	if len(cfg.Models) == 0 {
+		return nil, "", fmt.Errorf("model config %q defines no models", path)
+	}
+
+	defaultPreset := cfg.Default
+	if defaultPreset == "" {
+		defaultPreset = cfg.Models[0].Name
+	}
+	return cfg.Models, defaultPreset, nil
+}
+
+// DefaultPresets returns the single local Ollama preset the server used
+// before model presets existed, for when no config file is present.
+func DefaultPresets() ([]ModelPreset, string) {
+	const name = "local"
+	return []ModelPreset{{
+		Name:          name,
+		Provider:      "ollama",
+		BaseURL:       "http://localhost:11434",
+		Model:         "llama3.1:8b",
+		ContextWindow: 8192,
+	}}, name
+}
@@ -0,0 +1,70 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/anthropic"
+	"github.com/tmc/langchaingo/llms/googleai"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+// newProviderModel constructs the langchaingo chat model for preset. Every
+// supported provider implements llms.Model, so the rest of the package never
+// needs to know which one a given preset talks to.
+func newProviderModel(preset ModelPreset) (llms.Model, error) {
+	apiKey := ""
+	if preset.APIKeyEnv != "" {
+		apiKey = os.Getenv(preset.APIKeyEnv)
+	}
+
+	switch preset.Provider {
+	case "openai":
+		opts := []openai.Option{openai.WithToken(apiKey), openai.WithModel(preset.Model)}
+		if preset.BaseURL != "" {
+			opts = append(opts, openai.WithBaseURL(preset.BaseURL))
+		}
+		return openai.New(opts...)
+
+	case "anthropic":
+		opts := []anthropic.Option{anthropic.WithToken(apiKey), anthropic.WithModel(preset.Model)}
+		if preset.BaseURL != "" {
+			opts = append(opts, anthropic.WithBaseURL(preset.BaseURL))
+		}
+		return anthropic.New(opts...)
+
+	case "googleai":
+		opts := []googleai.Option{googleai.WithAPIKey(apiKey), googleai.WithDefaultModel(preset.Model)}
+		return googleai.New(context.Background(), opts...)
+
+	case "ollama":
+		// llms/ollama never reads CallOptions.Tools and never returns
+		// ToolCalls (there's nothing in langchaingo's ollama client that
+		// even references them), so agent.Agent's tool-calling loop would
+		// silently never invoke a tool against it. Ollama's OpenAI-compatible
+		// /v1 endpoint does support tool calls, and internal/embeddings
+		// already talks to it the same way, so route through llms/openai
+		// instead of langchaingo's native ollama provider.
+		baseURL := preset.BaseURL
+		if baseURL == "" {
+			baseURL = "http://localhost:11434"
+		}
+		baseURL = strings.TrimSuffix(baseURL, "/") + "/v1"
+
+		token := apiKey
+		if token == "" {
+			// Ollama's OpenAI-compatible endpoint doesn't check this, but
+			// the openai client refuses to start with an empty token.
+			token = "ollama"
+		}
+
+		opts := []openai.Option{openai.WithToken(token), openai.WithModel(preset.Model), openai.WithBaseURL(baseURL)}
+		return openai.New(opts...)
+
+	default:
+		return nil, fmt.Errorf("model preset %q: unknown provider %q", preset.Name, preset.Provider)
+	}
+}
@@ -4,32 +4,42 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"sort"
-	"strconv"
 	"strings"
 	"time"
 
-	"github.com/RichardoC/Pad-i/internal/db"
+	"github.com/RichardoC/Pad-i/internal/agent"
+	"github.com/RichardoC/Pad-i/internal/db/sqlite"
 	"github.com/RichardoC/Pad-i/internal/models"
+	"github.com/RichardoC/Pad-i/internal/trace"
 	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/openai"
 )
 
-type Service struct {
-	llm llms.LLM
-	db  *db.Database
-}
+// Default retrieval depth and relevance bar for SearchKnowledge, used
+// internally by processMessage and exported for callers like the HTTP
+// handler that want the same defaults when a caller doesn't specify them.
+const (
+	DefaultSearchTopK     = 5
+	DefaultSearchMinScore = 0.5
+)
 
-type StoreInfo struct {
-	UserInput   []string `json:"user_input"`   // Array of user messages
-	BotResponse []string `json:"bot_response"` // Array of assistant responses
-}
+// DefaultStarterCount is how many prompt starters GenerateStarters and
+// GenerateStartersForAgent produce when the caller doesn't specify a limit.
+const DefaultStarterCount = 4
 
-type LLMResponse struct {
-	Action    string    `json:"action"`     // "reply", "store", "search", or "new_conversation"
-	Content   string    `json:"content"`    // The actual response content
-	StoreInfo StoreInfo `json:"store_info"` // Optional: Information to store in knowledge base
-	NewTitle  string    `json:"new_title"`  // Optional: Title for new conversation
+// starterCacheTTL bounds how long a conversation's generated starters stay
+// valid before GenerateStarters regenerates them, so a UI that refreshes
+// often doesn't pay an LLM round trip on every load.
+const starterCacheTTL = 5 * time.Minute
+
+type Service struct {
+	models        map[string]llms.Model
+	presets       map[string]ModelPreset
+	presetOrder   []string
+	defaultPreset string
+	tokens        *tokenCounter
+	db            *sqlite.Database
+	workspaceRoot string
+	tracer        *trace.Recorder
 }
 
 type KnowledgeSearchResult struct {
@@ -38,224 +48,443 @@ type KnowledgeSearchResult struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
-func New(baseURL, token, model string, database *db.Database) (*Service, error) {
-	llm, err := openai.New(
-		openai.WithToken(token),
-		openai.WithBaseURL(baseURL),
-		openai.WithModel(model),
-	)
-	if err != nil {
-		return nil, err
+// New constructs a Service backed by one chat model per preset, each built
+// from presets according to its Provider (openai, anthropic, googleai, or
+// ollama). defaultPreset selects which one ProcessMessage uses when a
+// request and its conversation don't name one. workspaceRoot scopes the
+// built-in dir_tree and read_file tools so agents can't read files outside
+// of it. tracer records the per-request trans_id steps ProcessMessage times,
+// for later lookup via GET /api/trace.
+func New(presets []ModelPreset, defaultPreset string, database *sqlite.Database, workspaceRoot string, tracer *trace.Recorder) (*Service, error) {
+	if len(presets) == 0 {
+		return nil, fmt.Errorf("at least one model preset is required")
+	}
+
+	models := make(map[string]llms.Model, len(presets))
+	byName := make(map[string]ModelPreset, len(presets))
+	order := make([]string, 0, len(presets))
+	for _, preset := range presets {
+		model, err := newProviderModel(preset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize model preset %q: %w", preset.Name, err)
+		}
+		models[preset.Name] = model
+		byName[preset.Name] = preset
+		order = append(order, preset.Name)
+	}
+
+	if _, ok := byName[defaultPreset]; !ok {
+		return nil, fmt.Errorf("default model preset %q is not defined", defaultPreset)
 	}
-	return &Service{llm: llm, db: database}, nil
+
+	return &Service{
+		models:        models,
+		presets:       byName,
+		presetOrder:   order,
+		defaultPreset: defaultPreset,
+		tokens:        newTokenCounter(),
+		db:            database,
+		workspaceRoot: workspaceRoot,
+		tracer:        tracer,
+	}, nil
 }
 
-func (s *Service) SearchKnowledge(ctx context.Context, query string) ([]KnowledgeSearchResult, error) {
-	// First, get raw search results from database
-	results, err := s.db.SearchKnowledge(query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to search knowledge base: %w", err)
+// Presets returns every configured model preset, in config-file order.
+func (s *Service) Presets() []ModelPreset {
+	out := make([]ModelPreset, len(s.presetOrder))
+	for i, name := range s.presetOrder {
+		out[i] = s.presets[name]
 	}
+	return out
+}
 
-	// Use LLM to evaluate relevance of each result
-	var knowledgeResults []KnowledgeSearchResult
-	for _, result := range results {
-		prompt := fmt.Sprintf(`
-		Query: %s
-		
-		Potential relevant information: %s
-		
-		Rate the relevance of this information to the query on a scale of 0.0 to 1.0.
-		Respond with only the number.`, query, result.Content)
+// HasPreset reports whether name is a configured model preset.
+func (s *Service) HasPreset(name string) bool {
+	_, ok := s.presets[name]
+	return ok
+}
 
-		completion, err := llms.GenerateFromSinglePrompt(ctx, s.llm, prompt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to evaluate relevance: %w", err)
-		}
+// HasEmbedder reports whether the underlying database has an embedder
+// configured, which HybridSearchKnowledge requires.
+func (s *Service) HasEmbedder() bool {
+	return s.db.HasEmbedder()
+}
 
-		relevance, err := strconv.ParseFloat(strings.TrimSpace(completion), 64)
-		if err != nil {
-			relevance = 0.0
-		}
+// resolveModel returns the chat model and preset for name, falling back to
+// the service's default preset when name is empty.
+func (s *Service) resolveModel(name string) (llms.Model, ModelPreset, error) {
+	if name == "" {
+		name = s.defaultPreset
+	}
+	model, ok := s.models[name]
+	if !ok {
+		return nil, ModelPreset{}, fmt.Errorf("unknown model preset %q", name)
+	}
+	return model, s.presets[name], nil
+}
 
-		if relevance > 0.3 { // Only include somewhat relevant results
-			knowledgeResults = append(knowledgeResults, KnowledgeSearchResult{
-				Content:   result.Content,
-				Relevance: relevance,
-				CreatedAt: result.CreatedAt,
-			})
+// builtinTools returns the tools every agent gets access to, scoped to the
+// conversation the current message belongs to. If scoped is true, the
+// result is further filtered down to just the tools named in allow,
+// matching a registered AgentDefinition's Tools allow-list -- an agent with
+// no tools named (allow empty or nil) gets none, rather than falling back
+// to every tool unfiltered. scoped false (no agent assigned to the
+// conversation) returns every built-in tool unfiltered; allow is ignored.
+func (s *Service) builtinTools(convID int64, scoped bool, allow []string) []agent.Tool {
+	all := []agent.Tool{
+		&agent.SearchKnowledgeTool{DB: s.db},
+		&agent.StoreKnowledgeTool{DB: s.db, ConvID: convID},
+		&agent.CreateConversationTool{DB: s.db},
+		&agent.DirTreeTool{Root: s.workspaceRoot},
+		&agent.ReadFileTool{Root: s.workspaceRoot},
+	}
+	if !scoped {
+		return all
+	}
+
+	allowed := make(map[string]bool, len(allow))
+	for _, name := range allow {
+		allowed[name] = true
+	}
+	filtered := make([]agent.Tool, 0, len(all))
+	for _, t := range all {
+		if allowed[t.Name()] {
+			filtered = append(filtered, t)
 		}
 	}
+	return filtered
+}
 
-	// Sort by relevance
-	sort.Slice(knowledgeResults, func(i, j int) bool {
-		return knowledgeResults[i].Relevance > knowledgeResults[j].Relevance
-	})
+// SearchKnowledge returns up to topK stored knowledge entries relevant to
+// query, ranked by embedding cosine similarity, dropping anything scoring
+// below minScore. This is a vector-similarity lookup computed in Go over an
+// FTS-prefiltered candidate set; it no longer asks the LLM to score each
+// candidate, which made search cost grow linearly with the knowledge base
+// size.
+func (s *Service) SearchKnowledge(ctx context.Context, query string, topK int, minScore float64) ([]KnowledgeSearchResult, error) {
+	start := time.Now()
+	results, err := s.db.SearchKnowledge(ctx, query, topK, minScore)
+	s.tracer.Record(trace.TransIDFromContext(ctx), "knowledge_search", fmt.Sprintf("query %q", query), time.Since(start))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search knowledge base: %w", err)
+	}
 
+	knowledgeResults := make([]KnowledgeSearchResult, len(results))
+	for i, result := range results {
+		knowledgeResults[i] = KnowledgeSearchResult{
+			Content:   result.Content,
+			Relevance: result.Score,
+			CreatedAt: result.CreatedAt,
+		}
+	}
 	return knowledgeResults, nil
 }
 
-func (s *Service) ProcessMessage(ctx context.Context, msg models.Message) (*models.Message, error) {
-	// First, search for relevant knowledge
-	knowledge, err := s.SearchKnowledge(ctx, msg.Content)
+// DefaultHybridAlpha weights HybridSearch's lexical and semantic rankers
+// evenly when a caller doesn't specify one.
+const DefaultHybridAlpha = 0.5
+
+// HybridSearchKnowledge returns up to topK stored knowledge entries relevant
+// to query, ranked by reciprocal rank fusion between FTS lexical matching
+// and embedding cosine similarity. alpha weights the two rankers: 1 is
+// FTS-only, 0 is semantic-only. Unlike SearchKnowledge, it can surface a
+// semantically close entry that shares no keywords with query.
+func (s *Service) HybridSearchKnowledge(ctx context.Context, query string, topK int, alpha float64) ([]KnowledgeSearchResult, error) {
+	start := time.Now()
+	results, err := s.db.HybridSearch(ctx, query, topK, alpha)
+	s.tracer.Record(trace.TransIDFromContext(ctx), "knowledge_search", fmt.Sprintf("hybrid query %q", query), time.Since(start))
 	if err != nil {
-		// Log but don't fail if knowledge search fails
-		fmt.Printf("Warning: failed to search knowledge: %v\n", err)
-		// Continue with empty knowledge
-		knowledge = []KnowledgeSearchResult{}
+		return nil, fmt.Errorf("failed to search knowledge base: %w", err)
 	}
 
-	// Build the prompt with system instructions and conversation history
-	systemPrompt := `You are an AI assistant that can:
-	1. Reply to users (action: "reply")
-	2. Store important information in a knowledge base (action: "store")
-	3. Search existing knowledge (action: "search")
-	4. Create new conversations when topics change significantly (action: "new_conversation")
+	knowledgeResults := make([]KnowledgeSearchResult, len(results))
+	for i, result := range results {
+		knowledgeResults[i] = KnowledgeSearchResult{
+			Content:   result.Content,
+			Relevance: result.Score,
+			CreatedAt: result.CreatedAt,
+		}
+	}
+	return knowledgeResults, nil
+}
 
-	When storing knowledge:
-	- Only store specific, important facts or information
-	- Extract and summarize the key information, don't store entire conversations
-	- Format the information clearly and concisely
+// ReindexKnowledge backfills embeddings for knowledge rows written before an
+// embedder was configured, returning the number of rows it embedded.
+func (s *Service) ReindexKnowledge(ctx context.Context) (int, error) {
+	return s.db.ReindexKnowledgeEmbeddings(ctx)
+}
 
+// ProcessMessage runs the agent tool-calling loop for msg (knowledge search
+// and storage, conversation creation, workspace file tools), blocking until
+// the LLM has produced a complete response.
+// modelName selects a configured model preset; if empty, msg's conversation's
+// stored preset is used, falling back to the service's default preset.
+func (s *Service) ProcessMessage(ctx context.Context, msg models.Message, modelName string) (*models.Message, error) {
+	return s.processMessage(ctx, msg, modelName, nil)
+}
 
-	When the user asks about previous information or references past conversations,
-	use the "reply" action to respond using the conversation history and knowledge provided.
-	Only use "search" when explicitly asked to search for something.
+// ProcessMessageStream behaves like ProcessMessage, but also invokes onDelta
+// with each chunk of the assistant's final reply, in the order the LLM
+// produced them. The chunks are not delivered live: agent.Agent.Run buffers
+// each turn and replays the final, tool-call-free turn's chunks only after
+// that turn's response has fully arrived. The persisted models.Message is
+// built the same way as ProcessMessage's. onDelta is never called
+// concurrently, and a non-nil error from it aborts the call before the reply
+// is saved.
+func (s *Service) ProcessMessageStream(ctx context.Context, msg models.Message, modelName string, onDelta func(delta string) error) (*models.Message, error) {
+	return s.processMessage(ctx, msg, modelName, onDelta)
+}
 
-	IMPORTANT: Your response must be a valid JSON object, but the "content" field should contain
-	your natural language response to the user, not JSON or technical details.
+const defaultSystemPrompt = `You are the default Pad-i assistant.
+
+You can call tools to search or store persistent knowledge, create a new
+conversation when the topic changes significantly, or inspect files under
+your workspace root. Prefer the search_knowledge tool before answering
+questions about previously stored information, and use store_knowledge to
+save specific, important facts rather than entire conversations.
+
+Once you have everything you need, answer the user directly in natural
+language.`
+
+func (s *Service) processMessage(ctx context.Context, msg models.Message, modelName string, onDelta func(delta string) error) (*models.Message, error) {
+	transID := trace.TransIDFromContext(ctx)
+	start := time.Now()
+	var dbElapsed time.Duration
+
+	// A request-level model always wins; otherwise defer to whatever preset
+	// the conversation was created with. If the conversation is assigned to
+	// a registered agent, that agent's system prompt and tool allow-list
+	// replace the defaults for this turn.
+	dbStart := time.Now()
+	conv, err := s.db.GetConversation(ctx, msg.ConvID)
+	dbElapsed += time.Since(dbStart)
+
+	systemPrompt := defaultSystemPrompt
+	var toolAllow []string
+	agentScoped := false
+	if err == nil {
+		if modelName == "" {
+			modelName = conv.Model
+		}
+		if conv.Agent != "" {
+			agentScoped = true
+			if agentDef, agentErr := s.db.GetAgentByName(ctx, conv.Agent); agentErr == nil {
+				systemPrompt = agentDef.SystemPrompt
+				toolAllow = agentDef.Tools
+			} else {
+				// conv.Agent no longer resolves (deleted, renamed, or a
+				// transient lookup error) -- fail closed to zero tools rather
+				// than silently falling back to the unrestricted default set.
+				toolAllow = nil
+			}
+		}
+	}
+	model, preset, err := s.resolveModel(modelName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve model: %w", err)
+	}
 
-	Respond with a JSON object containing:
-	{
-		"action": "reply|store|search|new_conversation",
-		"content": "Your natural language response here...",
-		"store_info": {
-			"user_input": ["The key information to store"],  // Extract only the important facts
-			"bot_response": ["Confirmation or clarification of the stored info"]
-		},
-		"new_title": "optional: title for new conversation if action is new_conversation"
-	}`
+	// First, search for relevant knowledge
+	knowledgeStart := time.Now()
+	knowledge, err := s.SearchKnowledge(ctx, msg.Content, DefaultSearchTopK, DefaultSearchMinScore)
+	knowledgeElapsed := time.Since(knowledgeStart)
+	if err != nil {
+		// Log but don't fail if knowledge search fails
+		fmt.Printf("Warning: failed to search knowledge: %v\n", err)
+		// Continue with empty knowledge
+		knowledge = []KnowledgeSearchResult{}
+	}
 
 	// Get conversation history
-	history, err := s.db.GetConversationHistory(msg.ConvID, 10)
+	dbStart = time.Now()
+	history, err := s.db.GetConversationHistory(ctx, msg.ConvID, 10)
+	dbElapsed += time.Since(dbStart)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get conversation history: %w", err)
 	}
 
-	// Build conversation context with knowledge
-	prompt := systemPrompt + "\n\nRelevant knowledge from database:\n"
+	// Build the system prompt with retrieved knowledge context
+	systemPrompt += "\n\nRelevant knowledge from database:\n"
 	for _, k := range knowledge {
-		prompt += fmt.Sprintf("- %s (relevance: %.2f)\n", k.Content, k.Relevance)
+		systemPrompt += fmt.Sprintf("- %s (relevance: %.2f)\n", k.Content, k.Relevance)
 	}
 
-	prompt += "\n\nConversation history:\n"
+	// Trim history to fit the preset's context window before adding it to
+	// the prompt, so a long-running conversation doesn't overflow a smaller
+	// model's window.
+	history = trimHistory(s.tokens, history, systemPrompt, msg.Content, preset.ContextWindow)
+
+	systemPrompt += "\n\nConversation history:\n"
 	for i := len(history) - 1; i >= 0; i-- {
-		prompt += fmt.Sprintf("%s: %s\n", history[i].Role, history[i].Content)
+		systemPrompt += fmt.Sprintf("%s: %s\n", history[i].Role, history[i].Content)
 	}
-	prompt += fmt.Sprintf("\nCurrent message:\n%s: %s\n\nResponse:", msg.Role, msg.Content)
+
+	a := agent.New("default", systemPrompt, s.builtinTools(msg.ConvID, agentScoped, toolAllow), model)
 
 	// Get response from LLM with timeout
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	completion, err := llms.GenerateFromSinglePrompt(ctx, s.llm, prompt)
+	var callOpts []llms.CallOption
+	if onDelta != nil {
+		callOpts = append(callOpts, llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+			return onDelta(string(chunk))
+		}))
+	}
+
+	llmStart := time.Now()
+	reply, err := a.Run(ctx, msg.Content, callOpts...)
+	llmElapsed := time.Since(llmStart)
+	s.tracer.Record(transID, "llm_call", preset.Name, llmElapsed)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate completion: %w", err)
+		return nil, fmt.Errorf("failed to run agent: %w", err)
 	}
 
-	// Parse the JSON response
-	var llmResponse LLMResponse
-	if err := json.Unmarshal([]byte(completion), &llmResponse); err != nil {
-		// If JSON parsing fails, treat the entire completion as the content
-		fmt.Printf("Warning: failed to parse LLM response as JSON: %v\nRaw response: %s\n", err, completion)
-		llmResponse = LLMResponse{
-			Action:  "reply",
-			Content: completion,
-		}
-	} else if strings.HasPrefix(llmResponse.Content, "{") || strings.HasPrefix(llmResponse.Content, "[") {
-		// If the content looks like JSON, it might be a raw response
-		// Try to extract just the message content
-		var rawJSON map[string]interface{}
-		if err := json.Unmarshal([]byte(llmResponse.Content), &rawJSON); err == nil {
-			if content, ok := rawJSON["content"].(string); ok {
-				llmResponse.Content = content
-			}
-		}
+	response := &models.Message{
+		ConvID:            msg.ConvID,
+		Role:              "assistant",
+		Content:           strings.TrimSpace(reply),
+		TransID:           transID,
+		KnowledgeSearchMS: knowledgeElapsed.Milliseconds(),
+		LLMMS:             llmElapsed.Milliseconds(),
+		DBMS:              dbElapsed.Milliseconds(),
+		LatencyMS:         time.Since(start).Milliseconds(),
 	}
+	if err := s.db.SaveMessage(ctx, response); err != nil {
+		return nil, fmt.Errorf("failed to save message: %w", err)
+	}
+	s.tracer.Record(transID, "message_saved", fmt.Sprintf("message %d", response.ID), time.Since(start))
+	return response, nil
+}
 
-	// Clean up any remaining JSON artifacts in the content
-	llmResponse.Content = strings.TrimSpace(llmResponse.Content)
-	if strings.HasPrefix(llmResponse.Content, "\"") && strings.HasSuffix(llmResponse.Content, "\"") {
-		// Remove surrounding quotes if present
-		llmResponse.Content = llmResponse.Content[1 : len(llmResponse.Content)-1]
+// GenerateStarters asks the LLM for up to limit short prompt suggestions
+// tailored to convID's recent history and retrieved knowledge context,
+// caching the result on the conversation row for starterCacheTTL. elapsed is
+// the time actually spent talking to the model, zero on a cache hit, so the
+// caller can surface it to the UI as a spinner budget.
+func (s *Service) GenerateStarters(ctx context.Context, convID int64, limit int) ([]string, time.Duration, error) {
+	if limit <= 0 {
+		limit = DefaultStarterCount
 	}
 
-	// Handle the response based on the action
-	switch llmResponse.Action {
-	case "reply":
-		response := &models.Message{
-			ConvID:  msg.ConvID,
-			Role:    "assistant",
-			Content: llmResponse.Content,
-		}
-		if err := s.db.SaveMessage(response); err != nil {
-			return nil, fmt.Errorf("failed to save message: %w", err)
-		}
-		return response, nil
-
-	case "store":
-		// Extract and format the key information
-		var storeContent strings.Builder
-		storeContent.WriteString("Knowledge Entry:\n")
-		for i := 0; i < len(llmResponse.StoreInfo.UserInput); i++ {
-			storeContent.WriteString(fmt.Sprintf("Information: %s\n", llmResponse.StoreInfo.UserInput[i]))
-			if i < len(llmResponse.StoreInfo.BotResponse) {
-				storeContent.WriteString(fmt.Sprintf("Context: %s\n", llmResponse.StoreInfo.BotResponse[i]))
-			}
-		}
+	cached, generatedAt, err := s.db.GetConversationStarters(ctx, convID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load cached starters: %w", err)
+	}
+	// A cache entry generated for a smaller limit can't satisfy a larger one,
+	// so only serve it when it has at least as many suggestions as asked for.
+	if len(cached) >= limit && time.Since(generatedAt) < starterCacheTTL {
+		return cached[:limit], 0, nil
+	}
 
-		content := storeContent.String()
-		fmt.Printf("Attempting to store knowledge: ConvID=%d, Content=%q\n", msg.ConvID, content)
+	conv, err := s.db.GetConversation(ctx, convID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load conversation: %w", err)
+	}
 
-		// Always use the current conversation ID
-		if err := s.db.SaveToKnowledgeBase(content, msg.ConvID); err != nil {
-			fmt.Printf("Warning: failed to store knowledge: %v\n", err)
-		} else {
-			fmt.Printf("Successfully stored knowledge in conversation %d\n", msg.ConvID)
-		}
-		fallthrough // Fall through to "reply" case
-
-	case "search":
-		// For search action, we still want to reply to the user
-		response := &models.Message{
-			ConvID:  msg.ConvID,
-			Role:    "assistant",
-			Content: llmResponse.Content,
-		}
-		if err := s.db.SaveMessage(response); err != nil {
-			return nil, fmt.Errorf("failed to save message: %w", err)
-		}
-		return response, nil
+	history, err := s.db.GetConversationHistory(ctx, convID, 10)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get conversation history: %w", err)
+	}
+
+	var recentText string
+	for i := len(history) - 1; i >= 0; i-- {
+		recentText += fmt.Sprintf("%s: %s\n", history[i].Role, history[i].Content)
+	}
+
+	knowledge, err := s.SearchKnowledge(ctx, recentText, DefaultSearchTopK, DefaultSearchMinScore)
+	if err != nil {
+		// Starters are a nice-to-have; don't fail the request over a search
+		// hiccup, same as processMessage.
+		knowledge = []KnowledgeSearchResult{}
+	}
+
+	starters, elapsed, err := s.generateStarterSuggestions(ctx, conv.Model, defaultSystemPrompt, recentText, knowledge, limit)
+	if err != nil {
+		return nil, elapsed, err
+	}
 
-	case "new_conversation":
-		// Create new conversation
-		newConv, err := s.db.CreateConversation(llmResponse.NewTitle)
+	if err := s.db.SaveConversationStarters(ctx, convID, starters); err != nil {
+		return nil, elapsed, fmt.Errorf("failed to cache starters: %w", err)
+	}
+	return starters, elapsed, nil
+}
+
+// GenerateStartersForAgent behaves like GenerateStarters, but for a
+// conversation that doesn't exist yet: with no history or stored model
+// preset to draw on, it builds suggestions from agentName's system prompt
+// instead. Nothing is cached, since there's no conversation row to cache it
+// on.
+func (s *Service) GenerateStartersForAgent(ctx context.Context, agentName string, limit int) ([]string, time.Duration, error) {
+	if limit <= 0 {
+		limit = DefaultStarterCount
+	}
+
+	systemPrompt := defaultSystemPrompt
+	if agentName != "" {
+		agentDef, err := s.db.GetAgentByName(ctx, agentName)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create new conversation: %w", err)
+			return nil, 0, fmt.Errorf("unknown agent %q: %w", agentName, err)
 		}
+		systemPrompt = agentDef.SystemPrompt
+	}
 
-		// Save the response in the new conversation
-		response := &models.Message{
-			ConvID:  newConv.ID,
-			Role:    "assistant",
-			Content: llmResponse.Content,
-		}
-		if err := s.db.SaveMessage(response); err != nil {
-			return nil, fmt.Errorf("failed to save message: %w", err)
-		}
-		return response, nil
+	return s.generateStarterSuggestions(ctx, "", systemPrompt, "", nil, limit)
+}
+
+// generateStarterSuggestions is the shared prompt-building and model call
+// behind GenerateStarters and GenerateStartersForAgent.
+func (s *Service) generateStarterSuggestions(ctx context.Context, modelName, basePrompt, recentText string, knowledge []KnowledgeSearchResult, limit int) ([]string, time.Duration, error) {
+	model, _, err := s.resolveModel(modelName)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to resolve model: %w", err)
+	}
+
+	prompt := basePrompt + "\n\nYou are suggesting short prompts a user could click to start or continue this conversation."
+	if recentText != "" {
+		prompt += "\n\nConversation history:\n" + recentText
+	}
+	for _, k := range knowledge {
+		prompt += fmt.Sprintf("\n- %s (relevance: %.2f)", k.Content, k.Relevance)
+	}
+	prompt += fmt.Sprintf("\n\nRespond with exactly %d short prompt suggestions (no more than about ten words each) as a JSON array of strings, and nothing else.", limit)
+
+	a := agent.New("starters", prompt, nil, model)
+
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	reply, err := a.Run(ctx, "Suggest prompt starters.")
+	elapsed := time.Since(start)
+	if err != nil {
+		return nil, elapsed, fmt.Errorf("failed to run agent: %w", err)
+	}
+
+	var starters []string
+	if err := json.Unmarshal([]byte(extractJSONArray(reply)), &starters); err != nil {
+		return nil, elapsed, fmt.Errorf("failed to parse starter suggestions: %w", err)
+	}
+	if len(starters) > limit {
+		starters = starters[:limit]
+	}
+	return starters, elapsed, nil
+}
 
-	default:
-		return nil, fmt.Errorf("unknown action: %s", llmResponse.Action)
+// extractJSONArray trims any leading/trailing text or markdown code fences a
+// model might wrap its JSON array response in, since Run's only contract is
+// "plain text reply," not a strict JSON body.
+func extractJSONArray(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "```json")
+	s = strings.TrimPrefix(s, "```")
+	s = strings.TrimSuffix(s, "```")
+	s = strings.TrimSpace(s)
+
+	start := strings.Index(s, "[")
+	end := strings.LastIndex(s, "]")
+	if start >= 0 && end >= start {
+		return s[start : end+1]
 	}
+	return s
 }
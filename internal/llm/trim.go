@@ -0,0 +1,65 @@
+package llm
+
+import (
+	"github.com/RichardoC/Pad-i/internal/models"
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// reservedReplyTokens is subtracted from a preset's context window before
+// trimming history, leaving room for the model's own response.
+const reservedReplyTokens = 1024
+
+// fallbackContextWindow is used when a preset doesn't specify one.
+const fallbackContextWindow = 8192
+
+// tokenCounter estimates how many tokens a piece of text costs. cl100k_base
+// is an OpenAI encoding, but it's a reasonable proxy for any provider here:
+// history trimming only needs to be roughly right, not exact, and the
+// alternative is a provider-specific tokenizer per preset.
+type tokenCounter struct {
+	enc *tiktoken.Tiktoken
+}
+
+func newTokenCounter() *tokenCounter {
+	enc, err := tiktoken.GetEncoding("cl100k_base")
+	if err != nil {
+		// No network access to fetch the BPE ranks, most likely. Fall back
+		// to a character-count estimate rather than failing startup.
+		return &tokenCounter{}
+	}
+	return &tokenCounter{enc: enc}
+}
+
+func (c *tokenCounter) Count(text string) int {
+	if c.enc == nil {
+		return len(text)/4 + 1
+	}
+	return len(c.enc.Encode(text, nil, nil))
+}
+
+// trimHistory drops the oldest messages from history (ordered newest-first,
+// matching db.GetConversationHistory) until systemPrompt, userMessage, and
+// the remaining history fit within contextWindow tokens, minus
+// reservedReplyTokens for the model's own response.
+func trimHistory(counter *tokenCounter, history []models.Message, systemPrompt, userMessage string, contextWindow int) []models.Message {
+	if contextWindow <= 0 {
+		contextWindow = fallbackContextWindow
+	}
+
+	budget := contextWindow - reservedReplyTokens - counter.Count(systemPrompt) - counter.Count(userMessage)
+	if budget <= 0 {
+		return nil
+	}
+
+	kept := make([]models.Message, 0, len(history))
+	used := 0
+	for _, msg := range history {
+		cost := counter.Count(msg.Content)
+		if used+cost > budget {
+			break
+		}
+		used += cost
+		kept = append(kept, msg)
+	}
+	return kept
+}
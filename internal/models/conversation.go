@@ -5,13 +5,43 @@ import "time"
 type Message struct {
     ID        int64     `json:"id"`
     ConvID    int64     `json:"conversation_id"`
+    ParentID  *int64    `json:"parent_id,omitempty"` // nil for a conversation's first message and its edited siblings
+    Branch    int64     `json:"branch"`              // distinguishes sibling messages created by editing
+    Active    bool      `json:"active"`               // whether this message is on the currently selected branch
     Role      string    `json:"role"` // user, assistant, or system
     Content   string    `json:"content"`
     CreatedAt time.Time `json:"created_at"`
+    Revision  int64     `json:"revision"` // optimistic-concurrency counter, bumped on each edit
+
+    // TransID is the trans_id of the request that produced this message, so
+    // it can be looked up later via GET /api/trace. Empty for rows written
+    // before request tracing existed.
+    TransID string `json:"trans_id,omitempty"`
+
+    // Latency fields are only populated on an assistant reply: the wall-clock
+    // time processMessage spent overall, and its breakdown across knowledge
+    // search, the LLM call, and database round trips.
+    LatencyMS         int64 `json:"latency_ms,omitempty"`
+    KnowledgeSearchMS int64 `json:"knowledge_search_ms,omitempty"`
+    LLMMS             int64 `json:"llm_ms,omitempty"`
+    DBMS              int64 `json:"db_ms,omitempty"`
 }
 
 type Conversation struct {
     ID        int64     `json:"id"`
     Title     string    `json:"title"`
+    Model     string    `json:"model,omitempty"` // name of the model preset this conversation uses
+    Agent     string    `json:"agent,omitempty"` // name of the AgentDefinition this conversation is scoped to, if any
     CreatedAt time.Time `json:"created_at"`
+    Revision  int64     `json:"revision"` // optimistic-concurrency counter, bumped on each title update
+}
+
+// AgentDefinition is a named, user-configured agent: a system prompt paired
+// with the subset of built-in tools it's allowed to call.
+type AgentDefinition struct {
+    ID           int64     `json:"id"`
+    Name         string    `json:"name"`
+    SystemPrompt string    `json:"system_prompt"`
+    Tools        []string  `json:"tools"`
+    CreatedAt    time.Time `json:"created_at"`
 } 
\ No newline at end of file
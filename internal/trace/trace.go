@@ -0,0 +1,92 @@
+// Package trace threads a per-request trans_id through context.Context and
+// records an ordered, in-memory log of what happened during each request, so
+// GET /api/trace can answer "what happened during this request" after the
+// fact — useful for debugging slow local-model responses and reproducing bad
+// completions.
+package trace
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type ctxKey struct{}
+
+// WithTransID returns a copy of ctx carrying transID, so downstream code
+// (zap log lines, persisted message rows) can tag itself with the same
+// request identifier.
+func WithTransID(ctx context.Context, transID string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, transID)
+}
+
+// TransIDFromContext returns the trans_id stored on ctx by WithTransID, or
+// "" if none was set.
+func TransIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// Event is one step recorded against a trans_id, in the order it happened.
+type Event struct {
+	Time       time.Time `json:"time"`
+	Step       string    `json:"step"`
+	Detail     string    `json:"detail,omitempty"`
+	DurationMS int64     `json:"duration_ms,omitempty"`
+}
+
+// maxTraces bounds how many trans_ids Recorder keeps at once. Every inbound
+// request gets a trace now, so without a cap a long-running server would
+// grow this map forever; once full, the oldest trans_id is dropped to make
+// room for the newest, on the assumption that recent requests are the ones
+// worth explaining.
+const maxTraces = 10000
+
+// Recorder keeps an in-memory, ordered log of Events per trans_id, for up to
+// the most recent maxTraces requests. It's process-local: restarting the
+// server loses history, which is fine for its purpose of explaining a
+// response that just came back.
+type Recorder struct {
+	mu     sync.Mutex
+	traces map[string][]Event
+	order  []string // trans_ids in the order they were first seen, oldest first
+}
+
+// NewRecorder returns an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{traces: make(map[string][]Event)}
+}
+
+// Record appends an Event to transID's log. It's a no-op if transID is
+// empty, so callers that don't have one handy (e.g. background work with no
+// request context) can call it unconditionally.
+func (r *Recorder) Record(transID, step, detail string, duration time.Duration) {
+	if transID == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.traces[transID]; !exists {
+		if len(r.order) >= maxTraces {
+			oldest := r.order[0]
+			r.order = r.order[1:]
+			delete(r.traces, oldest)
+		}
+		r.order = append(r.order, transID)
+	}
+	r.traces[transID] = append(r.traces[transID], Event{
+		Time:       time.Now(),
+		Step:       step,
+		Detail:     detail,
+		DurationMS: duration.Milliseconds(),
+	})
+}
+
+// Get returns the recorded Events for transID, in the order they happened,
+// and whether anything has been recorded for it at all.
+func (r *Recorder) Get(transID string) ([]Event, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events, ok := r.traces[transID]
+	return events, ok
+}